@@ -21,7 +21,9 @@ func InitLogger() {
 	Logger.SetLevel(logrus.InfoLevel)
 }
 
-func ConnectDB() (*sql.DB, error) {
+// OpenDB connects to Postgres only. The migrate subcommand uses it directly
+// so schema changes can be applied without Redis being up.
+func OpenDB() (*sql.DB, error) {
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("\033[31m[-] Can't open .env file: %v\n\033[0m ", err)
@@ -32,8 +34,6 @@ func ConnectDB() (*sql.DB, error) {
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
-	redisHost := os.Getenv("REDIS_HOST")
-	redisPort := os.Getenv("REDIS_PORT")
 
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", dbHost, dbPort, dbUser, dbPassword, dbName)
 	db, err := sql.Open("postgres", connStr)
@@ -50,6 +50,17 @@ func ConnectDB() (*sql.DB, error) {
 	}
 
 	fmt.Println("\033[35m[-] Connected to database successfully!\033[0m")
+	return db, nil
+}
+
+func ConnectDB() (*sql.DB, error) {
+	db, err := OpenDB()
+	if err != nil {
+		return nil, err
+	}
+
+	redisHost := os.Getenv("REDIS_HOST")
+	redisPort := os.Getenv("REDIS_PORT")
 
 	RedisClient = redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%s", redisHost, redisPort),
@@ -65,61 +76,5 @@ func ConnectDB() (*sql.DB, error) {
 
 	fmt.Println("\033[35m[-] Redis Connected Successfully!\033[0m")
 
-	createTables(db)
 	return db, nil
 }
-func createTables(db *sql.DB) {
-
-	createUserTable := `
-	CREATE TABLE IF NOT EXISTS users (
-    	user_id SERIAL PRIMARY KEY,
-    	name TEXT NOT NULL,
-    	email VARCHAR(255) UNIQUE NOT NULL,
-		mobile VARCHAR(15) UNIQUE NOT NULL,
-    	password TEXT NOT NULL,
-    	aadhaar BIGINT UNIQUE NOT NULL,
-    	u_address TEXT,
-    	upf_img BYTEA,
-    	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createPropertyTable := `
-	CREATE TABLE IF NOT EXISTS properties (
-    	property_id SERIAL PRIMARY KEY,
-	    user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
-    	type VARCHAR(50) NOT NULL,
-    	p_address TEXT NOT NULL,
-    	prize DECIMAL(12,2) NOT NULL,
-    	map_link TEXT,
-    	img BYTEA,
-    	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	createAppointmentTable := `
-	CREATE TABLE IF NOT EXISTS appointments (
-    	appointment_id SERIAL PRIMARY KEY,
-    	user_id INT REFERENCES users(user_id) ON DELETE CASCADE,
-    	property_id INT REFERENCES properties(property_id) ON DELETE CASCADE,
-    	time TIME NOT NULL,
-    	date DATE NOT NULL,
-    	mobile VARCHAR(15) NOT NULL,
-    	address TEXT NOT NULL,
-    	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);`
-
-	if _, err := db.Exec(createUserTable); err != nil {
-		log.Fatalf("\033[31m[-] Error creating users table: %v\n\033[0m", err)
-	}
-	if _, err := db.Exec(createPropertyTable); err != nil {
-		log.Fatalf("\033[31m[-] Error creating propertys table: %v\n\033[0m", err)
-	}
-	if _, err := db.Exec(createAppointmentTable); err != nil {
-		log.Fatalf("\033[31m[-] Error creating appointments table: %v\n\033[0m", err)
-	}
-
-	fmt.Println("\033[35m[-] Table Created Successfully\033[0m")
-
-}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"time"
+
+	"github.com/prem0x01/propertyAPI/notify"
+)
+
+// NewDispatcher wires up the alert channels. Email goes through SMTP_ADDR and
+// SMS through SMS_WEBHOOK_URL; channels without a provider are only logged.
+func NewDispatcher() notify.Dispatcher {
+	d := notify.Dispatcher{
+		notify.Email: notify.LogSender{Channel: notify.Email, Logger: Logger},
+		notify.SMS:   notify.LogSender{Channel: notify.SMS, Logger: Logger},
+		notify.InApp: notify.Discard{},
+	}
+
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		var auth smtp.Auth
+		if user := os.Getenv("SMTP_USER"); user != "" {
+			host, _, _ := net.SplitHostPort(addr)
+			auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		d[notify.Email] = notify.SMTPSender{Addr: addr, From: envOr("SMTP_FROM", "alerts@localhost"), Auth: auth}
+	}
+	if url := os.Getenv("SMS_WEBHOOK_URL"); url != "" {
+		d[notify.SMS] = notify.WebhookSender{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return d
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/prem0x01/propertyAPI/storage"
+)
+
+// NewBlobStore builds the blob store selected by BLOB_STORE ("local" by
+// default, or "s3" for any S3 compatible service).
+func NewBlobStore() (storage.BlobStore, error) {
+	switch backend := os.Getenv("BLOB_STORE"); backend {
+	case "", "local":
+		dir := envOr("BLOB_DIR", "static/uploads")
+		return storage.NewLocalStore(dir, envOr("BLOB_BASE_URL", "/static/uploads"))
+	case "s3":
+		endpoint, bucket := os.Getenv("S3_ENDPOINT"), os.Getenv("S3_BUCKET")
+		if endpoint == "" || bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 blob store")
+		}
+		return storage.NewS3Store(endpoint, bucket, envOr("S3_REGION", "us-east-1"),
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), os.Getenv("S3_PUBLIC_URL")), nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORE %q", backend)
+	}
+}
+
+// ImageCacheDir is where resized images are cached, IMAGE_CACHE_DIR or
+// cache/images by default.
+func ImageCacheDir() string {
+	return envOr("IMAGE_CACHE_DIR", "cache/images")
+}
+
+// ImageCacheMaxBytes caps the disk used by the resized image cache,
+// IMAGE_CACHE_MAX_MB or 1024 MB by default.
+func ImageCacheMaxBytes() int64 {
+	mb, err := strconv.ParseInt(os.Getenv("IMAGE_CACHE_MAX_MB"), 10, 64)
+	if err != nil || mb <= 0 {
+		mb = 1024
+	}
+	return mb << 20
+}
+
+// UploadDir is where resumable upload chunks are staged, UPLOAD_DIR or
+// tmp/uploads by default.
+func UploadDir() string {
+	return envOr("UPLOAD_DIR", "tmp/uploads")
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
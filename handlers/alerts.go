@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/notify"
+	"github.com/sirupsen/logrus"
+)
+
+// digestInterval is how long daily searches collect alerts before they are
+// sent together.
+const digestInterval = 24 * time.Hour
+
+// instantRetryDelay keeps the digest sweep away from instant alerts the
+// matcher is still delivering.
+const instantRetryDelay = 10 * time.Minute
+
+var notifier notify.Dispatcher
+
+// alertQueue holds listings that were just published and still have to be
+// matched against saved searches. The request that published them only
+// enqueues, so a slow match never holds up the response.
+var alertQueue = make(chan int, 256)
+
+func InitNotifier(d notify.Dispatcher) {
+	notifier = d
+}
+
+// queueAlertMatch schedules a newly published listing for matching. When the
+// queue is full the listing is dropped and logged rather than blocking.
+func queueAlertMatch(propertyID int) {
+	select {
+	case alertQueue <- propertyID:
+	default:
+		config.Logger.Warn("Alert queue full, listing not matched", logrus.Fields{"property_id": propertyID})
+	}
+}
+
+// RunAlertMatcher matches queued listings against saved searches until the
+// process exits.
+func RunAlertMatcher() {
+	for propertyID := range alertQueue {
+		if err := matchSavedSearches(propertyID); err != nil {
+			config.Logger.Error("Failed to match saved searches", logrus.Fields{"property_id": propertyID, "error": err})
+		}
+	}
+}
+
+type savedSearchMatch struct {
+	searchID  int
+	principal middleware.Principal
+	query     string
+	frequency string
+}
+
+// matchSavedSearches runs every saved search, other than the lister's own,
+// restricted to propertyID and records an alert for each one that matches.
+// Instant alerts go out right away, daily ones wait for SendAlertDigests.
+func matchSavedSearches(propertyID int) error {
+	rows, err := db.Query(`SELECT s.search_id, s.user_id, u.role, s.query, s.frequency
+		FROM saved_searches s
+		JOIN users u ON u.user_id = s.user_id
+		JOIN properties p ON p.property_id = $1
+		WHERE s.user_id <> p.user_id`, propertyID)
+	if err != nil {
+		return err
+	}
+	var searches []savedSearchMatch
+	for rows.Next() {
+		var s savedSearchMatch
+		if err := rows.Scan(&s.searchID, &s.principal.UserID, &s.principal.Role, &s.query, &s.frequency); err != nil {
+			rows.Close()
+			return err
+		}
+		searches = append(searches, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var instant []int
+	for _, s := range searches {
+		q, _ := url.ParseQuery(s.query)
+		filter, err := parsePropertyFilter(q, s.principal)
+		if err != nil {
+			// The query was valid when saved; skip it if the filters changed since.
+			config.Logger.Warn("Skipping invalid saved search", logrus.Fields{"search_id": s.searchID, "error": err})
+			continue
+		}
+
+		var qb queryBuilder
+		qb.cond("p.property_id = " + qb.arg(propertyID))
+		where, _ := filter.where(&qb)
+		var matches bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM properties p`+where+`)`, qb.args...).Scan(&matches); err != nil {
+			return err
+		}
+		if !matches {
+			continue
+		}
+
+		var alertID int
+		err = db.QueryRow(`INSERT INTO search_alerts (search_id, property_id) VALUES ($1, $2)
+			ON CONFLICT (search_id, property_id) DO NOTHING RETURNING alert_id`, s.searchID, propertyID).Scan(&alertID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if s.frequency == models.FrequencyInstant {
+			instant = append(instant, alertID)
+		}
+	}
+
+	if len(instant) == 0 {
+		return nil
+	}
+	alerts, err := loadPendingAlerts("a.alert_id = ANY($1)", pq.Array(instant))
+	if err != nil {
+		return err
+	}
+	for _, a := range alerts {
+		dispatchAlerts([]pendingAlert{a})
+	}
+	return nil
+}
+
+// SendAlertDigests sends the pending alerts of daily searches once a day,
+// checking every interval. The same sweep retries instant alerts whose
+// delivery failed.
+func SendAlertDigests(interval time.Duration) {
+	for {
+		if err := sendDueDigests(); err != nil {
+			config.Logger.Error("Failed to send alert digests", logrus.Fields{"error": err})
+		}
+		time.Sleep(interval)
+	}
+}
+
+func sendDueDigests() error {
+	alerts, err := loadPendingAlerts(`a.sent_at IS NULL AND (
+			(s.frequency = $1 AND (s.last_digest_at IS NULL OR s.last_digest_at <= CURRENT_TIMESTAMP - make_interval(secs => $2)))
+			OR (s.frequency = $3 AND a.created_at <= CURRENT_TIMESTAMP - make_interval(secs => $4)))`,
+		models.FrequencyDaily, digestInterval.Seconds(), models.FrequencyInstant, instantRetryDelay.Seconds())
+	if err != nil {
+		return err
+	}
+
+	bySearch := map[int][]pendingAlert{}
+	var order []int
+	for _, a := range alerts {
+		if _, ok := bySearch[a.searchID]; !ok {
+			order = append(order, a.searchID)
+		}
+		bySearch[a.searchID] = append(bySearch[a.searchID], a)
+	}
+	for _, searchID := range order {
+		if dispatchAlerts(bySearch[searchID]) && bySearch[searchID][0].frequency == models.FrequencyDaily {
+			if _, err := db.Exec("UPDATE saved_searches SET last_digest_at = CURRENT_TIMESTAMP WHERE search_id = $1", searchID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pendingAlert is an alert joined with everything needed to deliver it.
+type pendingAlert struct {
+	alertID    int
+	searchID   int
+	searchName string
+	channel    string
+	frequency  string
+	to         string
+	property   models.Property
+}
+
+// loadPendingAlerts loads the alerts matching cond, ordered by search. Alerts
+// for listings that were taken down since they matched are left out.
+func loadPendingAlerts(cond string, args ...interface{}) ([]pendingAlert, error) {
+	rows, err := db.Query(`SELECT a.alert_id, s.search_id, s.name, s.channel, s.frequency, u.user_id, u.email, u.mobile,
+		p.property_id, p.type, p.p_address, p.prize, p.listing_kind, p.monthly_rent
+		FROM search_alerts a
+		JOIN saved_searches s ON s.search_id = a.search_id
+		JOIN users u ON u.user_id = s.user_id
+		JOIN properties p ON p.property_id = a.property_id
+		WHERE p.status = '`+models.StatusPublished+`' AND (`+cond+`)
+		ORDER BY s.search_id, a.created_at, a.alert_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []pendingAlert
+	for rows.Next() {
+		var a pendingAlert
+		var userID int
+		var email, mobile string
+		var monthlyRent sql.NullFloat64
+		if err := rows.Scan(&a.alertID, &a.searchID, &a.searchName, &a.channel, &a.frequency, &userID, &email, &mobile,
+			&a.property.PropertyID, &a.property.Type, &a.property.PAddress, &a.property.Prize,
+			&a.property.ListingKind, &monthlyRent); err != nil {
+			return nil, err
+		}
+		a.property.MonthlyRent = nullFloat(monthlyRent)
+		switch a.channel {
+		case notify.Email:
+			a.to = email
+		case notify.SMS:
+			a.to = mobile
+		default:
+			a.to = strconv.Itoa(userID)
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+// dispatchAlerts delivers alerts of one search as a single message and marks
+// them sent. Failed deliveries stay pending and are logged.
+func dispatchAlerts(alerts []pendingAlert) bool {
+	first := alerts[0]
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := notifier.Send(ctx, first.channel, alertMessage(alerts)); err != nil {
+		config.Logger.Error("Failed to deliver alert", logrus.Fields{"search_id": first.searchID, "channel": first.channel, "error": err})
+		return false
+	}
+
+	ids := make([]int, len(alerts))
+	for i, a := range alerts {
+		ids[i] = a.alertID
+	}
+	if _, err := db.Exec("UPDATE search_alerts SET sent_at = CURRENT_TIMESTAMP WHERE alert_id = ANY($1)", pq.Array(ids)); err != nil {
+		config.Logger.Error("Failed to mark alerts sent", logrus.Fields{"search_id": first.searchID, "error": err})
+	}
+	return true
+}
+
+func alertMessage(alerts []pendingAlert) notify.Message {
+	name := alerts[0].searchName
+	m := notify.Message{To: alerts[0].to}
+	if len(alerts) == 1 {
+		m.Subject = fmt.Sprintf("New listing for %q", name)
+	} else {
+		m.Subject = fmt.Sprintf("%d new listings for %q", len(alerts), name)
+	}
+
+	var b strings.Builder
+	for _, a := range alerts {
+		p := a.property
+		if p.ListingKind == models.ListingSale || p.MonthlyRent == nil {
+			fmt.Fprintf(&b, "- %s, %s: %.0f (property %d)\n", p.Type, p.PAddress, p.Prize, p.PropertyID)
+		} else {
+			fmt.Fprintf(&b, "- %s, %s: %.0f per month (property %d)\n", p.Type, p.PAddress, *p.MonthlyRent, p.PropertyID)
+		}
+	}
+	m.Body = b.String()
+	return m
+}
@@ -2,14 +2,16 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/imaging"
 	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
 )
 
 var (
@@ -36,16 +38,65 @@ func AppointmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type appointmentListItem struct {
+	Appointment models.Appointment `json:"appointment"`
+	UserName    string             `json:"user_name"`
+	UserEmail   string             `json:"user_email"`
+	Property    models.Property    `json:"property"`
+	createdAt   time.Time
+}
+
 func viewAppointment(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	pg, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status := q.Get("status")
+	if status != "" && !models.IsValidAppointmentStatus(status) {
+		http.Error(w, "invalid status", http.StatusBadRequest)
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	rows, err := db.Query(`SELECT
-		a.appointment_id, a.time, a.date, a.mobile, a.address, u.user_id, u.name, u.email,
-		p.property_id, p.type, p.p_address, p.prize, p.map_link, p.image
+	var qb queryBuilder
+
+	// Everyone but admins only sees visits they booked or visits to their own listings.
+	if !canListAllAppointments(principal) {
+		id := qb.arg(principal.UserID)
+		qb.cond("(a.user_id = " + id + " OR p.user_id = " + id + ")")
+	}
+	if status != "" {
+		qb.cond("a.status = " + qb.arg(status))
+	}
+
+	var total int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM appointments a
+		JOIN properties p ON a.property_id = p.property_id`+qb.whereClause(), qb.args...).Scan(&total)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pg.keysetCond(&qb, "a.created_at", "a.appointment_id")
+
+	query := `SELECT
+		a.appointment_id, a.time, a.date, a.duration_minutes, a.status, a.mobile, a.address, a.created_at, u.user_id, u.name, u.email,
+		p.property_id, p.type, p.p_address, p.prize, p.listing_kind, p.monthly_rent, p.map_link, p.img_key
 		FROM appointments a
 		JOIN users u ON a.user_id = u.user_id
-		JOIN properties p ON a.property_id = p.property_id`)
+		JOIN properties p ON a.property_id = p.property_id` + qb.whereClause() +
+		` ORDER BY ` + pg.keysetOrder("a.created_at", "a.appointment_id") + pg.limit(&qb)
+
+	rows, err := db.Query(query, qb.args...)
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -53,47 +104,51 @@ func viewAppointment(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var appointments []struct {
-		Appointment models.Appointment `json:"appointment"`
-		UserName    string             `json:"user_name"`
-		UserEmail   string             `json:"user_email"`
-		Property    models.Property    `json:"property"`
-	}
+	appointments := []appointmentListItem{}
 
 	for rows.Next() {
 		var a models.Appointment
 		var p models.Property
-		var imageData []byte
+		var imgKey sql.NullString
+		var monthlyRent sql.NullFloat64
 		var userName, userEmail string
+		var createdAt time.Time
 
-		if err := rows.Scan(&a.AppointmentID, &a.Time, &a.Date, &a.Mobile, &a.Address,
+		if err := rows.Scan(&a.AppointmentID, &a.Time, &a.Date, &a.DurationMinutes, &a.Status, &a.Mobile, &a.Address, &createdAt,
 			&a.UserID, &userName, &userEmail,
-			&p.PropertyID, &p.Type, &p.PAddress, &p.Prize, &p.MapLink, &imageData); err != nil {
+			&p.PropertyID, &p.Type, &p.PAddress, &p.Prize, &p.ListingKind, &monthlyRent, &p.MapLink, &imgKey); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		p.Img = base64.StdEncoding.EncodeToString(imageData)
+		p.ImgURL = blobURL(imgKey)
+		p.ThumbURL = renditionURL(imgKey, imaging.Thumb)
+		p.MonthlyRent = nullFloat(monthlyRent)
 
-		appointments = append(appointments, struct {
-			Appointment models.Appointment `json:"appointment"`
-			UserName    string             `json:"user_name"`
-			UserEmail   string             `json:"user_email"`
-			Property    models.Property    `json:"property"`
-		}{
+		appointments = append(appointments, appointmentListItem{
 			Appointment: a,
 			UserName:    userName,
 			UserEmail:   userEmail,
 			Property:    p,
+			createdAt:   createdAt,
 		})
 
 	}
 
+	appointments, next, prev := keysetPage(pg, appointments, func(item appointmentListItem) utils.Cursor {
+		return utils.Cursor{CreatedAt: item.createdAt, ID: item.Appointment.AppointmentID}
+	})
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(appointments)
+	json.NewEncoder(w).Encode(paginatedResponse(pg, appointments, total, next, prev))
 }
 
 func addAppointment(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	var a models.Appointment
 	err := json.NewDecoder(r.Body).Decode(&a)
 	if err != nil {
@@ -101,21 +156,43 @@ func addAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Visits are always booked for the caller, whatever the payload says.
+	a.UserID = principal.UserID
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	stmt, err := db.Prepare("INSERT INTO appointments(user_id, property_id, time, date, mobile, address) VALUES($1, $2, $3, $4, $5, $6) RETURNING appointment_id")
+	if a.DurationMinutes, err = visitSlot(a.PropertyID, &a); err != nil {
+		writeSlotError(w, err)
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	err = stmt.QueryRow(a.UserID, a.PropertyID, a.Time, a.Date, a.Mobile, a.Address).Scan(&a.AppointmentID)
+	err = tx.QueryRow(`INSERT INTO appointments(user_id, property_id, time, date, duration_minutes, mobile, address)
+		VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING appointment_id, status`,
+		a.UserID, a.PropertyID, a.Time, a.Date, a.DurationMinutes, a.Mobile, a.Address).Scan(&a.AppointmentID, &a.Status)
+	if isExclusionViolation(err, appointmentOverlapConstraint) {
+		writeSlotConflict(w, a.PropertyID, &a)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if err := recordAppointmentChange(tx, a.AppointmentID, "", "", principal.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(a)
@@ -136,35 +213,86 @@ func updateAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	stmt, err := db.Prepare("UPDATE appointments SET time=$1, date=$2, mobile=$3, address=$4 WHERE appointment_id=$5")
+	if !authorizeAppointment(w, principal, appointmentID) {
+		return
+	}
+
+	if _, _, err := normalizeVisit(&a); err != nil {
+		writeSlotError(w, err)
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
-
-	res, err := stmt.Exec(a.Time, a.Date, a.Mobile, a.Address, appointmentID)
+	defer tx.Rollback()
+
+	var propertyID int
+	var current string
+	var prevDate, prevTime time.Time
+	err = tx.QueryRow(`SELECT property_id, status, date, time, duration_minutes FROM appointments
+		WHERE appointment_id = $1 FOR UPDATE`, appointmentID).Scan(&propertyID, &current, &prevDate, &prevTime, &a.DurationMinutes)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		http.Error(w, "Error checking update status", http.StatusInternalServerError)
+	// Only visits that can still be rescheduled can be edited at all.
+	if !models.CanTransitionAppointment(current, models.AppointmentRescheduled) {
+		http.Error(w, "Cannot change a "+current+" appointment", http.StatusConflict)
 		return
 	}
 
-	if rowsAffected == 0 {
-		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+	// A new slot must be free on the same property and needs the owner to
+	// confirm it again.
+	a.Status = current
+	moved := a.Date != prevDate.Format(dateLayout) || a.Time != prevTime.Format(slotTimeLayout)
+	if moved {
+		if a.DurationMinutes, err = visitSlot(propertyID, &a); err != nil {
+			writeSlotError(w, err)
+			return
+		}
+		a.Status = models.AppointmentRescheduled
+	}
+
+	_, err = tx.Exec(`UPDATE appointments SET time = $1, date = $2, duration_minutes = $3, status = $4, mobile = $5, address = $6,
+		updated_at = CURRENT_TIMESTAMP WHERE appointment_id = $7`,
+		a.Time, a.Date, a.DurationMinutes, a.Status, a.Mobile, a.Address, appointmentID)
+	if isExclusionViolation(err, appointmentOverlapConstraint) {
+		writeSlotConflict(w, propertyID, &a)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if moved {
+		if err := recordAppointmentChange(tx, appointmentID, current, "", principal.UserID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Appointment updated successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Appointment updated successfully", "status": a.Status})
 }
 
 func deleteAppointment(w http.ResponseWriter, r *http.Request) {
@@ -176,10 +304,19 @@ func deleteAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	stmt, err := db.Prepare("DELETE FROM appointments WHERE appointment_id = ?")
+	if !authorizeAppointment(w, principal, appointmentID) {
+		return
+	}
+
+	stmt, err := db.Prepare("DELETE FROM appointments WHERE appointment_id = $1")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+const maxReasonLength = 500
+
+type appointmentAction struct {
+	to string
+	// byOwner marks actions taken by the owner of the property rather than
+	// the user who booked the visit.
+	byOwner bool
+}
+
+// appointmentActions maps the transition endpoints to the status they move a
+// visit to. Declining is the owner cancelling a visit.
+var appointmentActions = map[string]appointmentAction{
+	"confirm":  {models.AppointmentConfirmed, true},
+	"decline":  {models.AppointmentCancelled, true},
+	"complete": {models.AppointmentCompleted, true},
+	"no-show":  {models.AppointmentNoShow, true},
+	"cancel":   {models.AppointmentCancelled, false},
+}
+
+// recordAppointmentChange appends the current state of appointmentID to its
+// history. from is empty for a new booking.
+func recordAppointmentChange(tx *sql.Tx, appointmentID int, from, reason string, userID int) error {
+	_, err := tx.Exec(`INSERT INTO appointment_history (appointment_id, from_status, to_status, date, time, reason, changed_by)
+		SELECT appointment_id, NULLIF($2, ''), status, date, time, $3, $4 FROM appointments WHERE appointment_id = $1`,
+		appointmentID, from, reason, userID)
+	return err
+}
+
+// AppointmentStatusHandler moves a visit through its lifecycle
+// (POST /appointment/{id}/{action}, e.g. /appointment/3/confirm). The body
+// may give a reason: {"reason": "..."}.
+func AppointmentStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	appointmentID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid appointment ID", http.StatusBadRequest)
+		return
+	}
+	action, ok := appointmentActions[vars["action"]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if len(body.Reason) > maxReasonLength {
+		http.Error(w, fmt.Sprintf("reason must be at most %d characters", maxReasonLength), http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var bookerID, ownerID int
+	var current string
+	var date, at time.Time
+	err = tx.QueryRow(`SELECT a.user_id, p.user_id, a.status, a.date, a.time
+		FROM appointments a JOIN properties p ON p.property_id = a.property_id
+		WHERE a.appointment_id = $1 FOR UPDATE OF a`, appointmentID).Scan(&bookerID, &ownerID, &current, &date, &at)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	allowed := canManageAppointment(principal, bookerID)
+	if action.byOwner {
+		allowed = canRespondToAppointment(principal, ownerID)
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if !models.CanTransitionAppointment(current, action.to) {
+		http.Error(w, "Cannot move a "+current+" appointment to "+action.to, http.StatusConflict)
+		return
+	}
+	if (action.to == models.AppointmentCompleted || action.to == models.AppointmentNoShow) &&
+		wallClockNow().Before(date.Add(time.Duration(clockMinutes(at))*time.Minute)) {
+		http.Error(w, "The visit has not taken place yet", http.StatusConflict)
+		return
+	}
+
+	var changedAt time.Time
+	err = tx.QueryRow(`UPDATE appointments SET status = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE appointment_id = $2 RETURNING updated_at`, action.to, appointmentID).Scan(&changedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := recordAppointmentChange(tx, appointmentID, current, body.Reason, principal.UserID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     action.to,
+		"changed_at": changedAt.Format(time.RFC3339),
+	})
+}
+
+// AppointmentHistoryHandler lists every change made to a visit, oldest first
+// (GET /appointment/{id}/history). Both the booker and the property owner
+// can see it.
+func AppointmentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	appointmentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid appointment ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizeAppointmentView(w, principal, appointmentID) {
+		return
+	}
+
+	rows, err := db.Query(`SELECT from_status, to_status, date, time, reason, changed_by, changed_at
+		FROM appointment_history WHERE appointment_id = $1 ORDER BY changed_at, history_id`, appointmentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := []models.AppointmentChange{}
+	for rows.Next() {
+		var c models.AppointmentChange
+		var from sql.NullString
+		var changedBy sql.NullInt64
+		var date, at, changedAt time.Time
+		if err := rows.Scan(&from, &c.ToStatus, &date, &at, &c.Reason, &changedBy, &changedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.FromStatus = from.String
+		c.ChangedBy = nullInt(changedBy)
+		c.Date = date.Format(dateLayout)
+		c.Time = at.Format(slotTimeLayout)
+		c.ChangedAt = changedAt.Format(time.RFC3339)
+		history = append(history, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+func serveAppointmentStatus(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/appointment/{id}/{action}", AppointmentStatusHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// expectAppointmentLock mocks appointment 1, booked by user 7 for a property
+// of user 5, starting at the wall clock time start.
+func expectAppointmentLock(mock sqlmock.Sqlmock, status string, start time.Time) {
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM appointments a JOIN properties p").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "user_id", "status", "date", "time"}).
+			AddRow(7, 5, status, date, clockValue(start.Hour(), start.Minute())))
+}
+
+func TestOwnerConfirmsAppointment(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	expectAppointmentLock(mock, models.AppointmentRequested, time.Now().AddDate(0, 0, 3))
+	mock.ExpectQuery("UPDATE appointments SET status").
+		WithArgs(models.AppointmentConfirmed, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectExec("INSERT INTO appointment_history").
+		WithArgs(1, models.AppointmentRequested, "", 5).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := serveAppointmentStatus(asUser(httptest.NewRequest(http.MethodPost, "/appointment/1/confirm", nil), 5, "owner"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuyerCancelsAppointmentWithReason(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	expectAppointmentLock(mock, models.AppointmentConfirmed, time.Now().AddDate(0, 0, 3))
+	mock.ExpectQuery("UPDATE appointments SET status").
+		WithArgs(models.AppointmentCancelled, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(time.Now()))
+	mock.ExpectExec("INSERT INTO appointment_history").
+		WithArgs(1, models.AppointmentConfirmed, "Found another place", 7).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := strings.NewReader(`{"reason": " Found another place "}`)
+	rec := serveAppointmentStatus(asUser(httptest.NewRequest(http.MethodPost, "/appointment/1/cancel", body), 7, "buyer"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppointmentStatusRules(t *testing.T) {
+	future := time.Now().AddDate(0, 0, 3)
+	tests := []struct {
+		name   string
+		action string
+		userID int
+		status string
+		start  time.Time
+		want   int
+	}{
+		{"buyer cannot confirm", "confirm", 7, models.AppointmentRequested, future, http.StatusForbidden},
+		{"owner cannot cancel for the buyer", "cancel", 5, models.AppointmentRequested, future, http.StatusForbidden},
+		{"cancelled is final", "confirm", 5, models.AppointmentCancelled, future, http.StatusConflict},
+		{"not confirmed yet", "complete", 5, models.AppointmentRequested, future, http.StatusConflict},
+		{"visit still ahead", "no-show", 5, models.AppointmentConfirmed, future, http.StatusConflict},
+		{"visit later today", "complete", 5, models.AppointmentConfirmed, wallClockNow().Add(2 * time.Hour), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		mock, teardown := setupMockDB(t)
+		expectAppointmentLock(mock, tt.status, tt.start)
+		mock.ExpectRollback()
+
+		rec := serveAppointmentStatus(asUser(httptest.NewRequest(http.MethodPost, "/appointment/1/"+tt.action, nil), tt.userID, "buyer"))
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rec.Code)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		teardown()
+	}
+}
+
+func TestUpdateAppointmentMovingSlotReschedules(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	date := visitDate()
+	day, _ := time.Parse(dateLayout, date)
+
+	mock.ExpectQuery("SELECT user_id FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT property_id, status, date, time, duration_minutes FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"property_id", "status", "date", "time", "duration_minutes"}).
+			AddRow(2, models.AppointmentConfirmed, day, clockValue(10, 0), 30))
+	expectDefaultSchedule(mock, 2)
+	mock.ExpectExec("UPDATE appointments SET time").
+		WithArgs("11:30:00", date, 30, models.AppointmentRescheduled, "1234567890", "Test Address", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO appointment_history").
+		WithArgs(1, models.AppointmentConfirmed, "", 7).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body, _ := json.Marshal(models.Appointment{Time: "11:30", Date: date, Mobile: "1234567890", Address: "Test Address"})
+	req := asUser(httptest.NewRequest(http.MethodPut, "/appointment/1", bytes.NewReader(body)), 7, "buyer")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/appointment/{id}", updateAppointment)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateAppointmentContactOnlyKeepsStatus(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	date := visitDate()
+	day, _ := time.Parse(dateLayout, date)
+
+	mock.ExpectQuery("SELECT user_id FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT property_id, status, date, time, duration_minutes FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"property_id", "status", "date", "time", "duration_minutes"}).
+			AddRow(2, models.AppointmentConfirmed, day, clockValue(10, 0), 45))
+	mock.ExpectExec("UPDATE appointments SET time").
+		WithArgs("10:00:00", date, 45, models.AppointmentConfirmed, "5550001111", "New Address", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	body, _ := json.Marshal(models.Appointment{Time: "10:00", Date: date, Mobile: "5550001111", Address: "New Address"})
+	req := asUser(httptest.NewRequest(http.MethodPut, "/appointment/1", bytes.NewReader(body)), 7, "buyer")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/appointment/{id}", updateAppointment)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"Property_App/models"
 	"bytes"
 	"encoding/json"
 	"net/http"
@@ -9,7 +8,11 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-redis/redis"
 	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/storage"
 )
 
 func setupMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
@@ -19,6 +22,16 @@ func setupMockDB(t *testing.T) (sqlmock.Sqlmock, func()) {
 	}
 
 	InitAppointmentHandler(db)
+
+	// Nothing listens here, so cache reads miss and writes are logged and
+	// dropped, the same as when Redis is down in production.
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: 0})
+
+	store, err := storage.NewLocalStore(t.TempDir(), "/static/uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitBlobStore(store)
 	return mock, func() {
 		db.Close()
 	}
@@ -32,18 +45,23 @@ func TestAddAppointment(t *testing.T) {
 		UserID:     1,
 		PropertyID: 2,
 		Time:       "12:30:00",
-		Date:       "2025-06-05",
+		Date:       visitDate(),
 		Mobile:     "1234567890",
 		Address:    "Test Address",
 	}
 
-	mock.ExpectPrepare("INSERT INTO appointment").
-		ExpectQuery().
-		WithArgs(appointment.UserID, appointment.PropertyID, appointment.Time, appointment.Date, appointment.Mobile, appointment.Address).
-		WillReturnRows(sqlmock.NewRows([]string{"appointment_id"}).AddRow(1))
+	expectDefaultSchedule(mock, appointment.PropertyID)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO appointments").
+		WithArgs(appointment.UserID, appointment.PropertyID, appointment.Time, appointment.Date, 30, appointment.Mobile, appointment.Address).
+		WillReturnRows(sqlmock.NewRows([]string{"appointment_id", "status"}).AddRow(1, models.AppointmentRequested))
+	mock.ExpectExec("INSERT INTO appointment_history").
+		WithArgs(1, "", "", appointment.UserID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	body, _ := json.Marshal(appointment)
-	req := httptest.NewRequest(http.MethodPost, "/appointment", bytes.NewReader(body))
+	req := asUser(httptest.NewRequest(http.MethodPost, "/appointment", bytes.NewReader(body)), 1, "buyer")
 	rec := httptest.NewRecorder()
 
 	AppointmentHandler(rec, req)
@@ -58,12 +76,15 @@ func TestDeleteAppointment(t *testing.T) {
 	mock, teardown := setupMockDB(t)
 	defer teardown()
 
+	mock.ExpectQuery("SELECT user_id FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
 	mock.ExpectPrepare("DELETE FROM appointment").
 		ExpectExec().
 		WithArgs(1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	req := httptest.NewRequest(http.MethodDelete, "/appointment/1", nil)
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/appointment/1", nil), 1, "buyer")
 	rec := httptest.NewRecorder()
 
 	router := mux.NewRouter()
@@ -74,3 +95,61 @@ func TestDeleteAppointment(t *testing.T) {
 		t.Fatalf("expected status 204, got %d", rec.Code)
 	}
 }
+
+func TestAddAppointmentStampsCaller(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	appointment := models.Appointment{
+		UserID:     99,
+		PropertyID: 2,
+		Time:       "12:30:00",
+		Date:       visitDate(),
+		Mobile:     "1234567890",
+		Address:    "Test Address",
+	}
+
+	expectDefaultSchedule(mock, appointment.PropertyID)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO appointments").
+		WithArgs(7, appointment.PropertyID, appointment.Time, appointment.Date, 30, appointment.Mobile, appointment.Address).
+		WillReturnRows(sqlmock.NewRows([]string{"appointment_id", "status"}).AddRow(1, models.AppointmentRequested))
+	mock.ExpectExec("INSERT INTO appointment_history").
+		WithArgs(1, "", "", 7).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body, _ := json.Marshal(appointment)
+	req := asUser(httptest.NewRequest(http.MethodPost, "/appointment", bytes.NewReader(body)), 7, "buyer")
+	rec := httptest.NewRecorder()
+
+	AppointmentHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateAppointmentForbiddenForOtherUser(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM appointments").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(3))
+
+	body, _ := json.Marshal(models.Appointment{Time: "10:00:00", Date: "2025-06-05"})
+	req := asUser(httptest.NewRequest(http.MethodPut, "/appointment/1", bytes.NewReader(body)), 4, "buyer")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/appointment/{id}", updateAppointment)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/utils"
+	"github.com/sirupsen/logrus"
+)
+
+var jwtSecret string
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Mobile   string `json:"mobile"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func InitAuthHandler(database *sql.DB, secret string) {
+	db = database
+	jwtSecret = secret
+}
+
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if (req.Email == "" && req.Mobile == "") || req.Password == "" {
+		http.Error(w, "Email or mobile and password are required", http.StatusBadRequest)
+		return
+	}
+
+	query, login := `SELECT user_id, password, role FROM users WHERE email = $1`, req.Email
+	if req.Email == "" {
+		query, login = `SELECT user_id, password, role FROM users WHERE mobile = $1`, req.Mobile
+	}
+
+	var userID int
+	var hash, role string
+	err := db.QueryRow(query, login).Scan(&userID, &hash, &role)
+	if err == sql.ErrNoRows || (err == nil && !utils.CheckPassword(req.Password, hash)) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Every login starts a new token family.
+	familyID, err := utils.RandomToken(16)
+	if err != nil {
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, userID, role, familyID)
+}
+
+// RefreshHandler trades a refresh token for a new access/refresh pair. The
+// presented refresh token is consumed; replaying it revokes the family.
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, familyID, err := utils.RotateRefreshToken(req.RefreshToken)
+	switch err {
+	case nil:
+	case utils.ErrRefreshTokenReused:
+		config.Logger.Warn("Refresh token reuse detected, family revoked")
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	case utils.ErrInvalidRefreshToken:
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	default:
+		config.Logger.Error("Failed to rotate refresh token", logrus.Fields{"error": err})
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	// Re-read the role so promotions and demotions apply on the next refresh.
+	var role string
+	err = db.QueryRow(`SELECT role FROM users WHERE user_id = $1`, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, userID, role, familyID)
+}
+
+// LogoutHandler revokes the token family of the given refresh token and, when
+// a bearer token is sent along, that access token as well.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	familyID, err := utils.LookupRefreshToken(req.RefreshToken)
+	if err == utils.ErrInvalidRefreshToken {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err == nil {
+		err = utils.RevokeTokenFamily(familyID)
+	}
+	if err != nil {
+		http.Error(w, "Failed to logout", http.StatusInternalServerError)
+		return
+	}
+
+	if tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); tokenString != "" {
+		if claims, err := utils.ParseAccessToken(tokenString, jwtSecret); err == nil {
+			jti, _ := claims["jti"].(string)
+			exp, _ := claims["exp"].(float64)
+			if err := utils.RevokeAccessToken(jti, time.Unix(int64(exp), 0)); err != nil {
+				http.Error(w, "Failed to logout", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeTokens(w http.ResponseWriter, userID int, role, familyID string) {
+	accessToken, err := utils.GenerateAccessToken(userID, role, familyID, jwtSecret)
+	if err != nil {
+		config.Logger.Error("Failed to sign access token", logrus.Fields{"error": err})
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := utils.IssueRefreshToken(userID, familyID)
+	if err != nil {
+		config.Logger.Error("Failed to store refresh token", logrus.Fields{"error": err})
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL.Seconds()),
+	})
+}
@@ -0,0 +1,590 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	clockLayout          = "15:04"
+	slotTimeLayout       = "15:04:05"
+	defaultSlotMinutes   = 30
+	minSlotMinutes       = 15
+	maxSlotMinutes       = 240
+	maxWindows           = 50
+	defaultSlotRangeDays = 14
+	maxSlotRangeDays     = 60
+	suggestionRangeDays  = 7
+	maxSuggestedSlots    = 5
+)
+
+// appointmentOverlapConstraint keeps visits to one property from overlapping.
+const appointmentOverlapConstraint = "appointments_no_overlap"
+
+var (
+	errNotASlot   = errors.New("the requested time is not an available visiting slot, see GET /property/{id}/slots")
+	errPastVisit  = errors.New("visits cannot be booked in the past")
+	errBadVisitAt = errors.New("invalid date or time, expected YYYY-MM-DD and HH:MM[:SS]")
+)
+
+// defaultWindows apply to properties whose owner has not set visiting hours:
+// every day from 09:00 to 19:00 in half hour slots.
+func defaultWindows() []models.AvailabilityWindow {
+	windows := make([]models.AvailabilityWindow, 7)
+	for d := range windows {
+		windows[d] = models.AvailabilityWindow{Weekday: d, Start: "09:00", End: "19:00", SlotMinutes: defaultSlotMinutes}
+	}
+	return windows
+}
+
+// parseClock parses "HH:MM" or "HH:MM:SS" into minutes since midnight.
+// Seconds must be zero, slots never start mid-minute.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse(slotTimeLayout, s)
+	if err != nil {
+		if t, err = time.Parse(clockLayout, s); err != nil {
+			return 0, err
+		}
+	}
+	if t.Second() != 0 {
+		return 0, fmt.Errorf("seconds are not supported")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clockMinutes is the time of day of a TIME column in minutes since
+// midnight. lib/pq scans TIME as a time.Time on 0000-01-01.
+func clockMinutes(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+func formatClock(minutes int, layout string) string {
+	return time.Date(0, 1, 1, minutes/60, minutes%60, 0, 0, time.UTC).Format(layout)
+}
+
+// wallClockNow is the current time as a wall clock reading in UTC, the same
+// footing dates and times from the database are put on.
+func wallClockNow() time.Time {
+	n := time.Now()
+	return time.Date(n.Year(), n.Month(), n.Day(), n.Hour(), n.Minute(), 0, 0, time.UTC)
+}
+
+type window struct {
+	start, end, slot int
+}
+
+// schedule is the visiting schedule of one property over a date range.
+type schedule struct {
+	windows   map[time.Weekday][]window
+	blackouts map[string]bool
+}
+
+// loadSchedule loads the windows of propertyID, falling back to the default
+// hours, and its blackouts between from and to.
+func loadSchedule(propertyID int, from, to time.Time) (*schedule, error) {
+	rows, err := db.Query(`SELECT weekday, start_time, end_time, slot_minutes
+		FROM property_availability WHERE property_id = $1 ORDER BY weekday, start_time`, propertyID)
+	if err != nil {
+		return nil, err
+	}
+	s := &schedule{windows: map[time.Weekday][]window{}, blackouts: map[string]bool{}}
+	for rows.Next() {
+		var weekday, slot int
+		var start, end time.Time
+		if err := rows.Scan(&weekday, &start, &end, &slot); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		day := time.Weekday(weekday)
+		s.windows[day] = append(s.windows[day], window{clockMinutes(start), clockMinutes(end), slot})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.windows) == 0 {
+		for _, w := range defaultWindows() {
+			start, err1 := parseClock(w.Start)
+			end, err2 := parseClock(w.End)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid default window %+v", w)
+			}
+			day := time.Weekday(w.Weekday)
+			s.windows[day] = append(s.windows[day], window{start, end, w.SlotMinutes})
+		}
+	}
+
+	blackouts, err := db.Query(`SELECT date FROM property_blackouts
+		WHERE property_id = $1 AND date BETWEEN $2 AND $3`, propertyID, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer blackouts.Close()
+	for blackouts.Next() {
+		var d time.Time
+		if err := blackouts.Scan(&d); err != nil {
+			return nil, err
+		}
+		s.blackouts[d.Format(dateLayout)] = true
+	}
+	return s, blackouts.Err()
+}
+
+// slotAt returns the length of the slot starting at minute on day, or false
+// when no slot starts then.
+func (s *schedule) slotAt(day time.Time, minute int) (int, bool) {
+	if s.blackouts[day.Format(dateLayout)] {
+		return 0, false
+	}
+	for _, w := range s.windows[day.Weekday()] {
+		if minute >= w.start && minute+w.slot <= w.end && (minute-w.start)%w.slot == 0 {
+			return w.slot, true
+		}
+	}
+	return 0, false
+}
+
+// normalizeVisit puts the date and time of a visit in the form they are
+// stored and compared in.
+func normalizeVisit(a *models.Appointment) (day time.Time, minute int, err error) {
+	if day, err = time.Parse(dateLayout, a.Date); err != nil {
+		return day, 0, errBadVisitAt
+	}
+	if minute, err = parseClock(a.Time); err != nil {
+		return day, 0, errBadVisitAt
+	}
+	a.Date = day.Format(dateLayout)
+	a.Time = formatClock(minute, slotTimeLayout)
+	return day, minute, nil
+}
+
+// visitSlot normalises the date and time of a visit to propertyID and
+// checks they are the start of a future slot, returning its length.
+func visitSlot(propertyID int, a *models.Appointment) (int, error) {
+	day, minute, err := normalizeVisit(a)
+	if err != nil {
+		return 0, err
+	}
+
+	if day.Add(time.Duration(minute) * time.Minute).Before(wallClockNow()) {
+		return 0, errPastVisit
+	}
+
+	s, err := loadSchedule(propertyID, day, day)
+	if err != nil {
+		return 0, err
+	}
+	duration, ok := s.slotAt(day, minute)
+	if !ok {
+		return 0, errNotASlot
+	}
+	return duration, nil
+}
+
+// writeSlotError maps visitSlot errors to responses.
+func writeSlotError(w http.ResponseWriter, err error) {
+	switch err {
+	case errBadVisitAt:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errNotASlot, errPastVisit:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type booking struct {
+	start, end int
+}
+
+// loadBookings returns the visits of propertyID between from and to that
+// hold their slot, keyed by date.
+func loadBookings(propertyID int, from, to time.Time) (map[string][]booking, error) {
+	rows, err := db.Query(`SELECT date, time, duration_minutes FROM appointments
+		WHERE property_id = $1 AND date BETWEEN $2 AND $3 AND status <> '`+models.AppointmentCancelled+`'`, propertyID, from.Format(dateLayout), to.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := map[string][]booking{}
+	for rows.Next() {
+		var day, at time.Time
+		var duration int
+		if err := rows.Scan(&day, &at, &duration); err != nil {
+			return nil, err
+		}
+		start := clockMinutes(at)
+		key := day.Format(dateLayout)
+		bookings[key] = append(bookings[key], booking{start, start + duration})
+	}
+	return bookings, rows.Err()
+}
+
+// freeSlots lists the slots between from and to that are in the future and
+// do not overlap a booking.
+func (s *schedule) freeSlots(from, to time.Time, bookings map[string][]booking) []models.Slot {
+	now := wallClockNow()
+	slots := []models.Slot{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format(dateLayout)
+		if s.blackouts[date] {
+			continue
+		}
+		for _, w := range s.windows[day.Weekday()] {
+		next:
+			for m := w.start; m+w.slot <= w.end; m += w.slot {
+				if day.Add(time.Duration(m) * time.Minute).Before(now) {
+					continue
+				}
+				for _, b := range bookings[date] {
+					if m < b.end && b.start < m+w.slot {
+						continue next
+					}
+				}
+				slots = append(slots, models.Slot{Date: date, Time: formatClock(m, slotTimeLayout), DurationMinutes: w.slot})
+			}
+		}
+	}
+	sortSlots(slots)
+	return slots
+}
+
+func sortSlots(slots []models.Slot) {
+	sort.SliceStable(slots, func(i, j int) bool {
+		if slots[i].Date != slots[j].Date {
+			return slots[i].Date < slots[j].Date
+		}
+		return slots[i].Time < slots[j].Time
+	})
+}
+
+func slotStart(date, at string) time.Time {
+	day, _ := time.Parse(dateLayout, date)
+	minute, _ := parseClock(at)
+	return day.Add(time.Duration(minute) * time.Minute)
+}
+
+// suggestSlots returns the free slots of propertyID closest to the visit a
+// asked for, looking up to a week ahead of its date.
+func suggestSlots(propertyID int, a *models.Appointment) ([]models.Slot, error) {
+	from, err := time.Parse(dateLayout, a.Date)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(0, 0, suggestionRangeDays-1)
+	s, err := loadSchedule(propertyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := loadBookings(propertyID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := s.freeSlots(from, to, bookings)
+	at := slotStart(a.Date, a.Time)
+	distance := func(slot models.Slot) time.Duration {
+		d := slotStart(slot.Date, slot.Time).Sub(at)
+		if d < 0 {
+			return -d
+		}
+		return d
+	}
+	sort.SliceStable(slots, func(i, j int) bool { return distance(slots[i]) < distance(slots[j]) })
+	if len(slots) > maxSuggestedSlots {
+		slots = slots[:maxSuggestedSlots]
+	}
+	sortSlots(slots)
+	return slots, nil
+}
+
+// writeSlotConflict answers a booking that overlaps another visit with 409
+// and the nearest free slots instead.
+func writeSlotConflict(w http.ResponseWriter, propertyID int, a *models.Appointment) {
+	slots, err := suggestSlots(propertyID, a)
+	if err != nil {
+		config.Logger.Error("Failed to suggest visiting slots", logrus.Fields{"property_id": propertyID, "error": err})
+		slots = []models.Slot{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":           "the slot is already booked",
+		"suggested_slots": slots,
+	})
+}
+
+// PropertySlotsHandler lists the bookable visiting slots of a property
+// (GET /property/{id}/slots?from=&to=). The range defaults to the next two
+// weeks and may span at most 60 days.
+func PropertySlotsHandler(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	now := wallClockNow()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		if from, err = time.Parse(dateLayout, raw); err != nil {
+			http.Error(w, "invalid from, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	to := from.AddDate(0, 0, defaultSlotRangeDays-1)
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		if to, err = time.Parse(dateLayout, raw); err != nil {
+			http.Error(w, "invalid to, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) || to.Sub(from) >= maxSlotRangeDays*24*time.Hour {
+		http.Error(w, fmt.Sprintf("to must be on or after from and at most %d days later", maxSlotRangeDays-1), http.StatusBadRequest)
+		return
+	}
+
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	s, err := loadSchedule(propertyID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookings, err := loadBookings(propertyID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.freeSlots(from, to, bookings))
+}
+
+// PropertyAvailabilityHandler shows (GET) and replaces (PUT) the visiting
+// hours and blackout dates of a property at /property/{id}/availability.
+func PropertyAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewAvailability(w, r)
+	case "PUT":
+		updateAvailability(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewAvailability(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	availability := models.Availability{Windows: []models.AvailabilityWindow{}, Blackouts: []models.Blackout{}}
+	rows, err := db.Query(`SELECT weekday, start_time, end_time, slot_minutes
+		FROM property_availability WHERE property_id = $1 ORDER BY weekday, start_time`, propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var win models.AvailabilityWindow
+		var start, end time.Time
+		if err := rows.Scan(&win.Weekday, &start, &end, &win.SlotMinutes); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		win.Start = start.Format(clockLayout)
+		win.End = end.Format(clockLayout)
+		availability.Windows = append(availability.Windows, win)
+	}
+	if len(availability.Windows) == 0 {
+		availability.Windows = defaultWindows()
+		availability.Default = true
+	}
+
+	// Past blackouts no longer matter to anyone.
+	blackouts, err := db.Query(`SELECT date, reason FROM property_blackouts
+		WHERE property_id = $1 AND date >= CURRENT_DATE ORDER BY date`, propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blackouts.Close()
+	for blackouts.Next() {
+		var b models.Blackout
+		var d time.Time
+		if err := blackouts.Scan(&d, &b.Reason); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		b.Date = d.Format(dateLayout)
+		availability.Blackouts = append(availability.Blackouts, b)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(availability)
+}
+
+// validateAvailability checks windows and blackouts and normalises their
+// times and dates. Windows on the same weekday may not overlap.
+func validateAvailability(a *models.Availability) error {
+	if len(a.Windows) > maxWindows {
+		return fmt.Errorf("at most %d windows are allowed", maxWindows)
+	}
+	byDay := map[int][]window{}
+	for i := range a.Windows {
+		win := &a.Windows[i]
+		if win.Weekday < 0 || win.Weekday > 6 {
+			return fmt.Errorf("weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		start, err1 := parseClock(win.Start)
+		end, err2 := parseClock(win.End)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid window time, expected HH:MM")
+		}
+		if win.SlotMinutes == 0 {
+			win.SlotMinutes = defaultSlotMinutes
+		}
+		if win.SlotMinutes < minSlotMinutes || win.SlotMinutes > maxSlotMinutes {
+			return fmt.Errorf("slot_minutes must be between %d and %d", minSlotMinutes, maxSlotMinutes)
+		}
+		if end-start < win.SlotMinutes {
+			return fmt.Errorf("window %s-%s is shorter than one slot", win.Start, win.End)
+		}
+		for _, other := range byDay[win.Weekday] {
+			if start < other.end && other.start < end {
+				return fmt.Errorf("windows on weekday %d overlap", win.Weekday)
+			}
+		}
+		byDay[win.Weekday] = append(byDay[win.Weekday], window{start, end, win.SlotMinutes})
+		win.Start, win.End = formatClock(start, clockLayout), formatClock(end, clockLayout)
+	}
+
+	seen := map[string]bool{}
+	for i := range a.Blackouts {
+		d, err := time.Parse(dateLayout, a.Blackouts[i].Date)
+		if err != nil {
+			return fmt.Errorf("invalid blackout date, expected YYYY-MM-DD")
+		}
+		a.Blackouts[i].Date = d.Format(dateLayout)
+		if seen[a.Blackouts[i].Date] {
+			return fmt.Errorf("blackout %s is listed twice", a.Blackouts[i].Date)
+		}
+		seen[a.Blackouts[i].Date] = true
+	}
+	return nil
+}
+
+// updateAvailability replaces the whole schedule. Sending no windows goes
+// back to the default hours; existing bookings are left alone.
+func updateAvailability(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	var a models.Availability
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAvailability(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := replaceAvailability(tx, propertyID, &a); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if a.Windows == nil {
+		a.Windows = []models.AvailabilityWindow{}
+	}
+	if a.Blackouts == nil {
+		a.Blackouts = []models.Blackout{}
+	}
+	if len(a.Windows) == 0 {
+		a.Windows = defaultWindows()
+		a.Default = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
+
+func replaceAvailability(tx *sql.Tx, propertyID int, a *models.Availability) error {
+	if _, err := tx.Exec("DELETE FROM property_availability WHERE property_id = $1", propertyID); err != nil {
+		return err
+	}
+	for _, win := range a.Windows {
+		if _, err := tx.Exec(`INSERT INTO property_availability (property_id, weekday, start_time, end_time, slot_minutes)
+			VALUES ($1, $2, $3, $4, $5)`, propertyID, win.Weekday, win.Start, win.End, win.SlotMinutes); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM property_blackouts WHERE property_id = $1", propertyID); err != nil {
+		return err
+	}
+	for _, b := range a.Blackouts {
+		if _, err := tx.Exec("INSERT INTO property_blackouts (property_id, date, reason) VALUES ($1, $2, $3)",
+			propertyID, b.Date, b.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+// visitDate is a date a week from now, safely in the future for bookings.
+func visitDate() string {
+	return time.Now().AddDate(0, 0, 7).Format(dateLayout)
+}
+
+// clockValue is a TIME column value as lib/pq scans it.
+func clockValue(hour, minute int) time.Time {
+	return time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+// expectDefaultSchedule mocks a property without visiting hours or blackouts.
+func expectDefaultSchedule(mock sqlmock.Sqlmock, propertyID int) {
+	mock.ExpectQuery("FROM property_availability").
+		WithArgs(propertyID).
+		WillReturnRows(sqlmock.NewRows([]string{"weekday", "start_time", "end_time", "slot_minutes"}))
+	mock.ExpectQuery("FROM property_blackouts").
+		WillReturnRows(sqlmock.NewRows([]string{"date"}))
+}
+
+func TestFreeSlots(t *testing.T) {
+	from := time.Date(2099, 3, 2, 0, 0, 0, 0, time.UTC) // a Monday
+	s := &schedule{
+		windows: map[time.Weekday][]window{
+			time.Monday:  {{start: 9 * 60, end: 11 * 60, slot: 45}},
+			time.Tuesday: {{start: 14 * 60, end: 15 * 60, slot: 30}},
+		},
+		blackouts: map[string]bool{"2099-03-03": true},
+	}
+	bookings := map[string][]booking{"2099-03-02": {{start: 9*60 + 50, end: 10*60 + 20}}}
+
+	slots := s.freeSlots(from, from.AddDate(0, 0, 7), bookings)
+	var got []string
+	for _, slot := range slots {
+		got = append(got, slot.Date+" "+slot.Time)
+	}
+	// 09:45 overlaps the booking, 10:30 would run past the window and the
+	// Tuesday is blacked out.
+	want := []string{"2099-03-02 09:00:00", "2099-03-09 09:00:00", "2099-03-09 09:45:00"}
+	if len(got) != len(want) {
+		t.Fatalf("got slots %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got slots %v, want %v", got, want)
+		}
+	}
+	if slots[0].DurationMinutes != 45 {
+		t.Fatalf("expected 45 minute slots, got %d", slots[0].DurationMinutes)
+	}
+}
+
+func TestValidateAvailability(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows []models.AvailabilityWindow
+		wantErr bool
+	}{
+		{"ok", []models.AvailabilityWindow{{Weekday: 1, Start: "09:00", End: "12:00"}, {Weekday: 1, Start: "12:00", End: "13:00:00"}}, false},
+		{"bad weekday", []models.AvailabilityWindow{{Weekday: 7, Start: "09:00", End: "12:00"}}, true},
+		{"bad time", []models.AvailabilityWindow{{Weekday: 1, Start: "9am", End: "12:00"}}, true},
+		{"shorter than a slot", []models.AvailabilityWindow{{Weekday: 1, Start: "09:00", End: "09:20", SlotMinutes: 30}}, true},
+		{"slot too short", []models.AvailabilityWindow{{Weekday: 1, Start: "09:00", End: "12:00", SlotMinutes: 5}}, true},
+		{"overlap", []models.AvailabilityWindow{{Weekday: 2, Start: "09:00", End: "12:00"}, {Weekday: 2, Start: "11:30", End: "14:00"}}, true},
+	}
+	for _, tt := range tests {
+		a := models.Availability{Windows: tt.windows}
+		err := validateAvailability(&a)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	a := models.Availability{
+		Windows:   []models.AvailabilityWindow{{Weekday: 1, Start: "09:00:00", End: "12:00"}},
+		Blackouts: []models.Blackout{{Date: "2099-01-01"}},
+	}
+	if err := validateAvailability(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Windows[0].Start != "09:00" || a.Windows[0].SlotMinutes != defaultSlotMinutes {
+		t.Fatalf("window not normalised: %+v", a.Windows[0])
+	}
+
+	a.Blackouts = append(a.Blackouts, models.Blackout{Date: "2099-01-01"})
+	if err := validateAvailability(&a); err == nil {
+		t.Fatal("expected duplicate blackout to be rejected")
+	}
+}
+
+func TestAddAppointmentOutsideSlots(t *testing.T) {
+	tests := []struct {
+		name string
+		at   string
+		date string
+		want int
+	}{
+		{"night", "03:00", visitDate(), http.StatusUnprocessableEntity},
+		{"not aligned", "10:10", visitDate(), http.StatusUnprocessableEntity},
+		{"past", "10:00", "2020-01-01", http.StatusUnprocessableEntity},
+		{"bad date", "10:00", "tomorrow", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		mock, teardown := setupMockDB(t)
+		if tt.want == http.StatusUnprocessableEntity && tt.date != "2020-01-01" {
+			expectDefaultSchedule(mock, 2)
+		}
+
+		body, _ := json.Marshal(models.Appointment{PropertyID: 2, Time: tt.at, Date: tt.date})
+		req := asUser(httptest.NewRequest(http.MethodPost, "/appointment", bytes.NewReader(body)), 7, "buyer")
+		rec := httptest.NewRecorder()
+
+		AppointmentHandler(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, rec.Code)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		teardown()
+	}
+}
+
+func TestAddAppointmentConflictSuggestsSlots(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	date := visitDate()
+	day, _ := time.Parse(dateLayout, date)
+
+	expectDefaultSchedule(mock, 2)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO appointments").
+		WillReturnError(&pq.Error{Code: "23P01", Constraint: appointmentOverlapConstraint})
+	expectDefaultSchedule(mock, 2)
+	mock.ExpectQuery("FROM appointments").
+		WithArgs(2, date, day.AddDate(0, 0, suggestionRangeDays-1).Format(dateLayout)).
+		WillReturnRows(sqlmock.NewRows([]string{"date", "time", "duration_minutes"}).AddRow(day, clockValue(10, 0), 30))
+	mock.ExpectRollback()
+
+	body, _ := json.Marshal(models.Appointment{PropertyID: 2, Time: "10:00", Date: date})
+	req := asUser(httptest.NewRequest(http.MethodPost, "/appointment", bytes.NewReader(body)), 7, "buyer")
+	rec := httptest.NewRecorder()
+
+	AppointmentHandler(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Suggested []models.Slot `json:"suggested_slots"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, slot := range resp.Suggested {
+		got = append(got, slot.Time)
+	}
+	want := []string{"09:00:00", "09:30:00", "10:30:00", "11:00:00", "11:30:00"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got suggestions %v, want %v", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPropertySlotsUsesOwnerWindows(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	from := time.Date(2099, 3, 2, 0, 0, 0, 0, time.UTC) // a Monday
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(5, models.StatusPublished))
+	mock.ExpectQuery("FROM property_availability").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"weekday", "start_time", "end_time", "slot_minutes"}).
+			AddRow(1, clockValue(17, 0), clockValue(18, 30), 30))
+	mock.ExpectQuery("FROM property_blackouts").
+		WillReturnRows(sqlmock.NewRows([]string{"date"}))
+	mock.ExpectQuery("FROM appointments").
+		WithArgs(2, "2099-03-02", "2099-03-02").
+		WillReturnRows(sqlmock.NewRows([]string{"date", "time", "duration_minutes"}).AddRow(from, clockValue(17, 30), 30))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/property/2/slots?from=2099-03-02&to=2099-03-02", nil), 7, "buyer")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/slots", PropertySlotsHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var slots []models.Slot
+	if err := json.NewDecoder(rec.Body).Decode(&slots); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, slot := range slots {
+		got = append(got, slot.Time)
+	}
+	if want := "17:00:00,18:00:00"; strings.Join(got, ",") != want {
+		t.Fatalf("got slots %v, want %s", got, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/ical"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+// calendarFeedLookbackDays keeps recent visits in subscribed feeds, so they
+// do not vanish from calendar apps the moment they are over.
+const calendarFeedLookbackDays = 30
+
+// calendarEventColumns and calendarEventFrom select what scanCalendarEvent
+// reads. SEQUENCE is the number of changes since booking, so every status
+// change or reschedule supersedes the copy calendar apps hold.
+const (
+	calendarEventColumns = `a.appointment_id, a.date, a.time, a.duration_minutes, a.status, a.mobile,
+		u.name, p.type, p.p_address,
+		(SELECT COUNT(*) - 1 FROM appointment_history h WHERE h.appointment_id = a.appointment_id)`
+	calendarEventFrom = ` FROM appointments a
+		JOIN users u ON u.user_id = a.user_id
+		JOIN properties p ON p.property_id = a.property_id`
+)
+
+// calendarStatuses maps visit statuses onto iCalendar event statuses.
+var calendarStatuses = map[string]string{
+	models.AppointmentRequested:   ical.Tentative,
+	models.AppointmentRescheduled: ical.Tentative,
+	models.AppointmentConfirmed:   ical.Confirmed,
+	models.AppointmentCompleted:   ical.Confirmed,
+	models.AppointmentNoShow:      ical.Confirmed,
+	models.AppointmentCancelled:   ical.Cancelled,
+}
+
+// appointmentUID never changes for a visit, so calendar apps update the
+// event they have instead of adding another.
+func appointmentUID(appointmentID int) string {
+	return fmt.Sprintf("appointment-%d@propertyapi", appointmentID)
+}
+
+func scanCalendarEvent(rows *sql.Rows) (ical.Event, error) {
+	var appointmentID, duration, sequence int
+	var date, at time.Time
+	var status, mobile, bookerName, propertyType, address string
+	if err := rows.Scan(&appointmentID, &date, &at, &duration, &status, &mobile,
+		&bookerName, &propertyType, &address, &sequence); err != nil {
+		return ical.Event{}, err
+	}
+
+	start := date.Add(time.Duration(clockMinutes(at)) * time.Minute)
+	if sequence < 0 {
+		sequence = 0
+	}
+	return ical.Event{
+		UID:         appointmentUID(appointmentID),
+		Sequence:    sequence,
+		Status:      calendarStatuses[status],
+		Start:       start,
+		End:         start.Add(time.Duration(duration) * time.Minute),
+		Summary:     fmt.Sprintf("Property visit: %s, %s", propertyType, address),
+		Location:    address,
+		Description: fmt.Sprintf("Booked by %s (%s)\nStatus: %s", bookerName, mobile, status),
+	}, nil
+}
+
+func writeCalendar(w http.ResponseWriter, c ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	c.Write(w, time.Now())
+}
+
+// AppointmentICSHandler exports one visit as an iCalendar file
+// (GET /appointment/{id}.ics) for either party of the visit.
+func AppointmentICSHandler(w http.ResponseWriter, r *http.Request) {
+	appointmentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid appointment ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizeAppointmentView(w, principal, appointmentID) {
+		return
+	}
+
+	rows, err := db.Query(`SELECT `+calendarEventColumns+calendarEventFrom+` WHERE a.appointment_id = $1`, appointmentID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+		return
+	}
+	event, err := scanCalendarEvent(rows)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCalendar(w, ical.Calendar{Events: []ical.Event{event}}, fmt.Sprintf("appointment-%d.ics", appointmentID))
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CalendarFeedHandler serves a user's visits, as buyer and as owner, to
+// calendar apps (GET /calendar/{token}.ics). The token stands in for a login,
+// since calendar apps cannot send one. Cancelled visits stay in the feed so
+// subscribers see them cancelled.
+func CalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM calendar_tokens WHERE token_hash = $1",
+		hashCalendarToken(mux.Vars(r)["token"])).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(`SELECT `+calendarEventColumns+calendarEventFrom+`
+		WHERE (a.user_id = $1 OR p.user_id = $1) AND a.date >= CURRENT_DATE - $2::int
+		ORDER BY a.date, a.time, a.appointment_id`, userID, calendarFeedLookbackDays)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	c := ical.Calendar{Name: "Property visits"}
+	for rows.Next() {
+		event, err := scanCalendarEvent(rows)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.Events = append(c.Events, event)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeCalendar(w, c, "")
+}
+
+// CalendarTokenHandler issues (POST) and revokes (DELETE) the feed URL of a
+// user at /user/{id}/calendar. Issuing again replaces the previous URL; the
+// token is only shown once.
+func CalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		token, err := utils.RandomToken(32)
+		if err != nil {
+			http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+			return
+		}
+		if _, err := db.Exec(`INSERT INTO calendar_tokens (user_id, token_hash) VALUES ($1, $2)
+			ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = CURRENT_TIMESTAMP`,
+			userID, hashCalendarToken(token)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{
+			"token": token,
+			"url":   "/calendar/" + token + ".ics",
+		})
+	case "DELETE":
+		if _, err := db.Exec("DELETE FROM calendar_tokens WHERE user_id = $1", userID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+var calendarEventRowColumns = []string{"appointment_id", "date", "time", "duration_minutes", "status", "mobile",
+	"name", "type", "p_address", "sequence"}
+
+func TestAppointmentICS(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT a.user_id, p.user_id").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "user_id"}).AddRow(7, 5))
+	mock.ExpectQuery("FROM appointments a").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(calendarEventRowColumns).
+			AddRow(1, time.Date(2030, 6, 5, 0, 0, 0, 0, time.UTC), clockValue(10, 30), 45, models.AppointmentCancelled,
+				"1234567890", "Asha", "flat", "12 Main St", 2))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/appointment/1.ics", nil), 5, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/appointment/{id:[0-9]+}.ics", AppointmentICSHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"UID:appointment-1@propertyapi\r\n",
+		"SEQUENCE:2\r\n",
+		"STATUS:CANCELLED\r\n",
+		"DTSTART:20300605T103000\r\n",
+		"DTEND:20300605T111500\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in\n%s", want, body)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("FROM calendar_tokens").
+		WithArgs(hashCalendarToken("abc123")).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectQuery("FROM appointments a").
+		WithArgs(7, calendarFeedLookbackDays).
+		WillReturnRows(sqlmock.NewRows(calendarEventRowColumns).
+			AddRow(1, time.Date(2030, 6, 5, 0, 0, 0, 0, time.UTC), clockValue(10, 30), 30, models.AppointmentRequested,
+				"1234567890", "Asha", "flat", "12 Main St", 0).
+			AddRow(2, time.Date(2030, 6, 6, 0, 0, 0, 0, time.UTC), clockValue(11, 0), 30, models.AppointmentConfirmed,
+				"1234567890", "Asha", "villa", "3 Hill Rd", 1))
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/abc123.ics", nil)
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/calendar/{token:[0-9a-f]+}.ics", CalendarFeedHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	if n := strings.Count(body, "BEGIN:VEVENT"); n != 2 {
+		t.Fatalf("expected 2 events, got %d", n)
+	}
+	if !strings.Contains(body, "STATUS:TENTATIVE\r\n") || !strings.Contains(body, "STATUS:CONFIRMED\r\n") {
+		t.Fatalf("statuses not mapped:\n%s", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalendarFeedUnknownToken(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("FROM calendar_tokens").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/calendar/deadbeef.ics", nil)
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/calendar/{token:[0-9a-f]+}.ics", CalendarFeedHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
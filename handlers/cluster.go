@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxClusterZoom = 22
+	// cellsPerTile splits each 256px map tile into a 4x4 grid, i.e. clusters
+	// roughly 64px apart on screen at any zoom level.
+	cellsPerTile = 4
+	maxClusters  = 5000
+)
+
+type propertyCluster struct {
+	Count    int          `json:"count"`
+	Centroid utils.LatLng `json:"centroid"`
+	// MinPrize and MaxPrize span the listings for sale, they are left out of
+	// cells holding only rentals.
+	MinPrize   *float64 `json:"min_prize,omitempty"`
+	MaxPrize   *float64 `json:"max_prize,omitempty"`
+	PropertyID int      `json:"property_id,omitempty"`
+}
+
+type clusterResponse struct {
+	Zoom        int               `json:"zoom"`
+	CellSizeDeg float64           `json:"cell_size_deg"`
+	Clusters    []propertyCluster `json:"clusters"`
+}
+
+// clusterCellSize returns the grid cell edge in degrees for a web map zoom
+// level, where zoom 0 shows the whole world in one tile.
+func clusterCellSize(zoom int) float64 {
+	return 360 / (math.Exp2(float64(zoom)) * cellsPerTile)
+}
+
+// PropertyClustersHandler aggregates listings inside bbox into grid cells so
+// zoomed out maps get one marker per cell instead of thousands of pins. All
+// GET /property filters apply.
+func PropertyClustersHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("bbox") == "" {
+		http.Error(w, "bbox is required", http.StatusBadRequest)
+		return
+	}
+	zoom, err := strconv.Atoi(q.Get("zoom"))
+	if err != nil || zoom < 0 || zoom > maxClusterZoom {
+		http.Error(w, fmt.Sprintf("zoom must be between 0 and %d", maxClusterZoom), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parsePropertyFilter(q, principal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cacheKey := propertyCacheKey(fmt.Sprintf("clusters:%d:%s", zoom, filter.cacheKey()))
+	if cached, err := config.RedisClient.Get(cacheKey).Result(); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(cached))
+		return
+	}
+
+	cell := clusterCellSize(zoom)
+
+	var qb queryBuilder
+	where, _ := filter.where(&qb)
+	cellArg := qb.arg(cell)
+
+	rows, err := db.Query(`SELECT COUNT(*), AVG(p.latitude), AVG(p.longitude),
+			MIN(p.prize) FILTER (WHERE p.listing_kind = '`+models.ListingSale+`'),
+			MAX(p.prize) FILTER (WHERE p.listing_kind = '`+models.ListingSale+`'),
+			MIN(p.property_id)
+		FROM properties p`+where+`
+		GROUP BY floor(p.latitude / `+cellArg+`), floor(p.longitude / `+cellArg+`)
+		ORDER BY COUNT(*) DESC
+		LIMIT `+qb.arg(maxClusters), qb.args...)
+	if err != nil {
+		config.Logger.Error("Failed to cluster properties", logrus.Fields{"error": err})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	resp := clusterResponse{Zoom: zoom, CellSizeDeg: cell, Clusters: []propertyCluster{}}
+	for rows.Next() {
+		var c propertyCluster
+		var propertyID int
+		if err := rows.Scan(&c.Count, &c.Centroid.Lat, &c.Centroid.Lng, &c.MinPrize, &c.MaxPrize, &propertyID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// A cluster of one is just a pin, let the client link it directly.
+		if c.Count == 1 {
+			c.PropertyID = propertyID
+		}
+		resp.Clusters = append(resp.Clusters, c)
+	}
+
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "Failed to encode clusters", http.StatusInternalServerError)
+		return
+	}
+	config.RedisClient.Set(cacheKey, string(jsonData), 10*time.Minute)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
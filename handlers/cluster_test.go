@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPropertyClusters(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery(`p.status = \$5 GROUP BY floor\(p.latitude / \$6\), floor\(p.longitude / \$6\)`).
+		WithArgs(18.4, 18.6, 73.7, 73.9, "published", clusterCellSize(12), maxClusters).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "lat", "lng", "min", "max", "id"}).
+			AddRow(12, 18.51, 73.81, 2500000.0, 9000000.0, 3).
+			AddRow(1, 18.55, 73.78, 4000000.0, 4000000.0, 17).
+			AddRow(2, 18.45, 73.72, nil, nil, 21))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/property/clusters?bbox=73.7,18.4,73.9,18.6&zoom=12", nil), 1, "buyer")
+	rec := httptest.NewRecorder()
+	PropertyClustersHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp clusterResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Clusters) != 3 || resp.Clusters[0].PropertyID != 0 || resp.Clusters[1].PropertyID != 17 {
+		t.Fatalf("unexpected clusters: %+v", resp.Clusters)
+	}
+	if p := resp.Clusters[0].MinPrize; p == nil || *p != 2500000 {
+		t.Fatalf("unexpected min prize %v", p)
+	}
+	if resp.Clusters[2].MinPrize != nil || resp.Clusters[2].MaxPrize != nil {
+		t.Fatal("a cell of rentals should have no prize range")
+	}
+}
+
+func TestPropertyClustersRequiresBBoxAndZoom(t *testing.T) {
+	for _, target := range []string{"/property/clusters?zoom=3", "/property/clusters?bbox=73.7,18.4,73.9,18.6&zoom=30"} {
+		req := asUser(httptest.NewRequest(http.MethodGet, target, nil), 1, "buyer")
+		rec := httptest.NewRecorder()
+		PropertyClustersHandler(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status 400, got %d", target, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// key, optionally of a specific constraint.
+func isUniqueViolation(err error, constraint string) bool {
+	return isConstraintError(err, "23505", constraint)
+}
+
+// isExclusionViolation reports whether err is Postgres rejecting a row that
+// conflicts with another under an exclusion constraint.
+func isExclusionViolation(err error, constraint string) bool {
+	return isConstraintError(err, "23P01", constraint)
+}
+
+func isConstraintError(err error, code pq.ErrorCode, constraint string) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != code {
+		return false
+	}
+	return constraint == "" || pqErr.Constraint == constraint
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+// favoriteCountColumn counts the users who saved the row of properties p.
+// Cached search pages are not invalidated when it changes, so counts there
+// may lag by up to the cache lifetime.
+const favoriteCountColumn = `(SELECT COUNT(*) FROM favorites f WHERE f.property_id = p.property_id)`
+
+type favoriteItem struct {
+	Property    models.Property `json:"property"`
+	FavoritedAt string          `json:"favorited_at"`
+	createdAt   time.Time
+}
+
+// FavoritesHandler manages a user's watchlist: GET /user/{id}/favorites lists
+// it, POST and DELETE /user/{id}/favorites/{property_id} add and remove a
+// listing.
+func FavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewFavorites(w, r)
+	case "POST":
+		addFavorite(w, r)
+	case "DELETE":
+		deleteFavorite(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewFavorites(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !canManageUser(principal, userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	pg, err := parsePagination(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Saved listings stay on the list once sold so buyers see what happened
+	// to them, but drafts and archived listings of other owners drop off.
+	var qb queryBuilder
+	id := qb.arg(userID)
+	qb.cond("f.user_id = " + id)
+	qb.cond("(p.status IN ('" + models.StatusPublished + "', '" + models.StatusUnderOffer + "', '" + models.StatusSold + "') OR p.user_id = " + id + ")")
+
+	var total int64
+	err = db.QueryRow(`SELECT COUNT(*) FROM favorites f
+		JOIN properties p ON f.property_id = p.property_id`+qb.whereClause(), qb.args...).Scan(&total)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pg.keysetCond(&qb, "f.created_at", "f.property_id")
+
+	rows, err := db.Query(`SELECT
+		p.property_id, p.type, p.p_address, p.prize, `+propertyListingColumns+`, p.img_key, p.user_id, p.created_at, p.status,
+		`+favoriteCountColumn+`, f.created_at
+		FROM favorites f
+		JOIN properties p ON f.property_id = p.property_id`+qb.whereClause()+
+		` ORDER BY `+pg.keysetOrder("f.created_at", "f.property_id")+pg.limit(&qb), qb.args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	favorites := []favoriteItem{}
+	for rows.Next() {
+		var item favoriteItem
+		var terms listingScan
+		var imgKey sql.NullString
+		var createdAt time.Time
+
+		dest := []interface{}{&item.Property.PropertyID, &item.Property.Type, &item.Property.PAddress, &item.Property.Prize}
+		dest = append(dest, terms.dest(&item.Property)...)
+		dest = append(dest, &imgKey, &item.Property.UserID, &createdAt, &item.Property.Status,
+			&item.Property.FavoriteCount, &item.createdAt)
+		if err := rows.Scan(dest...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		terms.apply(&item.Property)
+		item.Property.ImgURL = blobURL(imgKey)
+		item.Property.ThumbURL = renditionURL(imgKey, imaging.Thumb)
+		item.Property.CreatedAt = createdAt.Format(time.RFC3339)
+		item.FavoritedAt = item.createdAt.Format(time.RFC3339)
+		favorites = append(favorites, item)
+	}
+
+	favorites, next, prev := keysetPage(pg, favorites, func(item favoriteItem) utils.Cursor {
+		return utils.Cursor{CreatedAt: item.createdAt, ID: item.Property.PropertyID}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginatedResponse(pg, favorites, total, next, prev))
+}
+
+// favoriteTarget parses the route and checks the caller may edit the
+// watchlist, writing the error response when not.
+func favoriteTarget(w http.ResponseWriter, r *http.Request) (principal middleware.Principal, userID, propertyID int, ok bool) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return principal, 0, 0, false
+	}
+	propertyID, err = strconv.Atoi(vars["property_id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return principal, 0, 0, false
+	}
+
+	if principal, ok = currentPrincipal(w, r); !ok {
+		return principal, 0, 0, false
+	}
+	if !canManageUser(principal, userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return principal, 0, 0, false
+	}
+	return principal, userID, propertyID, true
+}
+
+func addFavorite(w http.ResponseWriter, r *http.Request) {
+	principal, userID, propertyID, ok := favoriteTarget(w, r)
+	if !ok {
+		return
+	}
+	// Only listings the user can see may be saved.
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	res, err := db.Exec(`INSERT INTO favorites (user_id, property_id) VALUES ($1, $2)
+		ON CONFLICT (user_id, property_id) DO NOTHING`, userID, propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM favorites WHERE property_id = $1", propertyID).Scan(&count); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if n, _ := res.RowsAffected(); n > 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]int{"property_id": propertyID, "favorite_count": count})
+}
+
+// deleteFavorite is idempotent: removing a listing that is not on the
+// watchlist still succeeds.
+func deleteFavorite(w http.ResponseWriter, r *http.Request) {
+	_, userID, propertyID, ok := favoriteTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM favorites WHERE user_id = $1 AND property_id = $2", userID, propertyID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
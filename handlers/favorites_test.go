@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func serveFavorites(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{id}/favorites", FavoritesHandler)
+	router.HandleFunc("/user/{id}/favorites/{property_id}", FavoritesHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFavoritesForbiddenForOtherUsers(t *testing.T) {
+	_, teardown := setupMockDB(t)
+	defer teardown()
+
+	rec := serveFavorites(asUser(httptest.NewRequest(http.MethodGet, "/user/3/favorites", nil), 9, "buyer"))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestAddFavorite(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(5, "published"))
+	mock.ExpectExec("INSERT INTO favorites").
+		WithArgs(9, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+
+	rec := serveFavorites(asUser(httptest.NewRequest(http.MethodPost, "/user/9/favorites/1", nil), 9, "buyer"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), `"favorite_count":4`) {
+		t.Fatalf("unexpected body %s", rec.Body.String())
+	}
+}
+
+func TestCannotFavoriteHiddenListing(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(5, "draft"))
+
+	rec := serveFavorites(asUser(httptest.NewRequest(http.MethodPost, "/user/9/favorites/1", nil), 9, "buyer"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/storage"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxResizeEdge = 2000
+	// Blob keys are never reused for different content, so a derivative
+	// can be cached by browsers and CDNs forever.
+	imageCacheControl = "public, max-age=31536000, immutable"
+)
+
+// resizeEdges are the sizes requested widths and heights are rounded up to.
+// The endpoint is public, so this keeps the number of derivatives of an
+// image, and the work to make them, small whatever clients ask for.
+var resizeEdges = []int{64, 128, 256, 320, 480, 640, 800, 1024, 1280, 1600, maxResizeEdge}
+
+var (
+	imageCacheDir      string
+	imageCacheMaxBytes int64
+	// imageCacheSize is an estimate of the bytes on disk; eviction recounts.
+	imageCacheSize  atomic.Int64
+	imageCacheEvict sync.Mutex
+)
+
+// InitImageCache sets the directory resized images are cached in and the
+// disk space it may use. An empty dir disables the cache.
+func InitImageCache(dir string, maxBytes int64) {
+	imageCacheDir = dir
+	imageCacheMaxBytes = maxBytes
+	imageCacheSize.Store(0)
+	if dir != "" {
+		files, _ := imageCacheFiles()
+		for _, f := range files {
+			imageCacheSize.Add(f.size)
+		}
+	}
+}
+
+type resizeParams struct {
+	Width, Height int
+	Format        string
+}
+
+// variant names the derivative, e.g. "w320_h0_auto".
+func (p resizeParams) variant() string {
+	format := p.Format
+	if format == "" {
+		format = "auto"
+	}
+	return fmt.Sprintf("w%d_h%d_%s", p.Width, p.Height, format)
+}
+
+func parseResizeParams(q url.Values) (resizeParams, error) {
+	var p resizeParams
+	for _, dim := range []struct {
+		name string
+		dst  *int
+	}{{"w", &p.Width}, {"h", &p.Height}} {
+		raw := q.Get(dim.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || v > maxResizeEdge {
+			return p, fmt.Errorf("invalid %s, expected a value between 1 and %d", dim.name, maxResizeEdge)
+		}
+		*dim.dst = snapResizeEdge(v)
+	}
+
+	switch format := q.Get("format"); format {
+	case "":
+	case "jpeg", "jpg":
+		p.Format = "jpeg"
+	case "png":
+		p.Format = "png"
+	default:
+		return p, fmt.Errorf("invalid format, expected jpeg or png")
+	}
+	return p, nil
+}
+
+func snapResizeEdge(v int) int {
+	for _, edge := range resizeEdges {
+		if v <= edge {
+			return edge
+		}
+	}
+	return maxResizeEdge
+}
+
+// ImageHandler serves a stored image resized on demand
+// (GET /images/{key}?w=&h=&format=). w and h are rounded up to the next of
+// resizeEdges, the image is scaled to fit inside w x h without upscaling, and
+// derivatives are cached on disk.
+func ImageHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if !storage.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	params, err := parseResizeParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	variant := params.variant()
+	etag := imageETag(key, variant)
+
+	// The original is opened first, even when the derivative is cached, so a
+	// deleted image is never answered from cache.
+	rc, err := blobs.Open(r.Context(), key)
+	if err == storage.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		config.Logger.Error("Failed to open image", logrus.Fields{"key": key, "error": err})
+		http.Error(w, "Failed to load image", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == etag {
+		rc.Close()
+		setImageCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cachePath := ""
+	if imageCacheDir != "" {
+		cachePath = filepath.Join(imageCacheDir, filepath.FromSlash(key), variant)
+		if f, err := os.Open(cachePath); err == nil {
+			rc.Close()
+			defer f.Close()
+			setImageCacheHeaders(w, etag)
+			// ServeContent sniffs the content type from the first bytes.
+			http.ServeContent(w, r, "", time.Time{}, f)
+			return
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxImageUpload+1))
+	rc.Close()
+	if err != nil {
+		http.Error(w, "Failed to load image", http.StatusInternalServerError)
+		return
+	}
+
+	enc, err := imaging.Resize(data, params.Width, params.Height, params.Format)
+	if err == imaging.ErrUnsupported {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if cachePath != "" {
+		if err := writeImageCache(cachePath, enc.Data); err != nil {
+			config.Logger.Warn("Failed to cache resized image", logrus.Fields{"key": key, "error": err})
+		} else if imageCacheSize.Add(int64(len(enc.Data))) > imageCacheMaxBytes {
+			evictImageCache()
+		}
+	}
+
+	setImageCacheHeaders(w, etag)
+	w.Header().Set("Content-Type", enc.ContentType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(enc.Data))
+}
+
+func imageETag(key, variant string) string {
+	sum := sha256.Sum256([]byte(key + "?" + variant))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setImageCacheHeaders is only called once the image is known to be served,
+// errors must not be cached for as long as images are.
+func setImageCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", imageCacheControl)
+}
+
+// writeImageCache writes through a temporary file so concurrent requests for
+// the same derivative never see a partial file.
+func writeImageCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+type imageCacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func imageCacheFiles() ([]imageCacheFile, error) {
+	var files []imageCacheFile
+	err := filepath.WalkDir(imageCacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, imageCacheFile{path, info.Size(), info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// evictImageCache deletes the oldest derivatives until the cache is back
+// under 90% of its limit. Only one request evicts at a time, the others
+// carry on.
+func evictImageCache() {
+	if !imageCacheEvict.TryLock() {
+		return
+	}
+	defer imageCacheEvict.Unlock()
+
+	files, err := imageCacheFiles()
+	if err != nil {
+		config.Logger.Warn("Failed to scan image cache", logrus.Fields{"error": err})
+		return
+	}
+	var total int64
+	for _, f := range files {
+		total += f.size
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	target := imageCacheMaxBytes / 10 * 9
+	for _, f := range files {
+		if total <= target {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		total -= f.size
+	}
+	imageCacheSize.Store(total)
+}
+
+// purgeImageCache drops every cached derivative of key.
+func purgeImageCache(key string) {
+	if imageCacheDir == "" || !storage.ValidKey(key) {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(imageCacheDir, filepath.FromSlash(key))); err != nil {
+		config.Logger.Warn("Failed to purge image cache", logrus.Fields{"key": key, "error": err})
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func serveImage(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/images/{key:.+}", ImageHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImageHandlerResizesAndCaches(t *testing.T) {
+	_, teardown := setupMockDB(t)
+	defer teardown()
+
+	cacheDir := t.TempDir()
+	InitImageCache(cacheDir, 1<<20)
+	defer InitImageCache("", 0)
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 400, 300)))
+	if err := blobs.Put(context.Background(), "properties/1/a.png", bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveImage(httptest.NewRequest(http.MethodGet, "/images/properties/1/a.png?w=100", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("expected image/png, got %q", ct)
+	}
+	if rec.Header().Get("Cache-Control") != imageCacheControl {
+		t.Fatalf("unexpected Cache-Control %q", rec.Header().Get("Cache-Control"))
+	}
+	cfg, err := png.DecodeConfig(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// w=100 is rounded up to the next edge.
+	if cfg.Width != 128 || cfg.Height != 96 {
+		t.Fatalf("expected 128x96, got %dx%d", cfg.Width, cfg.Height)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "properties/1/a.png/w128_h0_auto")); err != nil {
+		t.Fatalf("derivative was not cached: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/images/properties/1/a.png?w=100", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	if rec := serveImage(req); rec.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304, got %d", rec.Code)
+	}
+
+	purgeImageCache("properties/1/a.png")
+	if _, err := os.Stat(filepath.Join(cacheDir, "properties/1/a.png")); !os.IsNotExist(err) {
+		t.Fatal("expected the cache to be purged")
+	}
+}
+
+func TestImageHandlerMissingImageIsNotCached(t *testing.T) {
+	_, teardown := setupMockDB(t)
+	defer teardown()
+
+	rec := serveImage(httptest.NewRequest(http.MethodGet, "/images/properties/1/gone.png?w=100", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+	if rec.Header().Get("Cache-Control") != "" || rec.Header().Get("ETag") != "" {
+		t.Fatalf("a 404 must not carry caching headers: %v", rec.Header())
+	}
+
+	// A client revalidating a deleted image must not be told it is unchanged.
+	req := httptest.NewRequest(http.MethodGet, "/images/properties/1/gone.png?w=100", nil)
+	req.Header.Set("If-None-Match", imageETag("properties/1/gone.png", "w128_h0_auto"))
+	if rec := serveImage(req); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestEvictImageCacheDropsOldestFirst(t *testing.T) {
+	cacheDir := t.TempDir()
+	InitImageCache(cacheDir, 100)
+	defer InitImageCache("", 0)
+
+	old := filepath.Join(cacheDir, "properties/1/a.png/w64_h0_auto")
+	recent := filepath.Join(cacheDir, "properties/2/b.png/w64_h0_auto")
+	for i, path := range []string{old, recent} {
+		if err := writeImageCache(path, make([]byte, 60)); err != nil {
+			t.Fatal(err)
+		}
+		stamp := time.Now().Add(time.Duration(i-2) * time.Hour)
+		os.Chtimes(path, stamp, stamp)
+	}
+
+	evictImageCache()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatal("expected the oldest derivative to be evicted")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Fatalf("expected the recent derivative to stay: %v", err)
+	}
+	if n := imageCacheSize.Load(); n != 60 {
+		t.Fatalf("expected 60 bytes cached, got %d", n)
+	}
+}
+
+func TestParseResizeParamsSnapsToEdges(t *testing.T) {
+	p, err := parseResizeParams(url.Values{"w": {"1"}, "h": {"1999"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Width != 64 || p.Height != maxResizeEdge {
+		t.Fatalf("unexpected params %+v", p)
+	}
+}
+
+func TestImageHandlerRejectsBadParams(t *testing.T) {
+	for _, target := range []string{"/images/a.png?w=0", "/images/a.png?h=5000", "/images/a.png?format=webp"} {
+		if rec := serveImage(httptest.NewRequest(http.MethodGet, target, nil)); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", target, rec.Code)
+		}
+	}
+}
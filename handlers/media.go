@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/storage"
+	"github.com/prem0x01/propertyAPI/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const maxImageUpload = 15 << 20
+
+var blobs storage.BlobStore
+
+var (
+	errUnsupportedImage = imaging.ErrUnsupported
+	errImageTooLarge    = errors.New("image too large")
+)
+
+func InitBlobStore(store storage.BlobStore) {
+	blobs = store
+}
+
+// storeUpload validates an uploaded image and writes a metadata free copy
+// plus its renditions into the blob store under prefix. It returns the key of
+// the original; rendition keys are derived with imaging.RenditionKey.
+func storeUpload(ctx context.Context, prefix string, file multipart.File, header *multipart.FileHeader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(file, maxImageUpload+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxImageUpload {
+		return "", errImageTooLarge
+	}
+
+	res, err := imaging.Process(data)
+	if err == imaging.ErrTooLarge {
+		return "", errImageTooLarge
+	}
+	if err != nil {
+		return "", err
+	}
+
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	key := path.Join(prefix, name+res.Original.Ext)
+
+	if err := putEncoded(ctx, key, res.Original); err != nil {
+		return "", err
+	}
+	for _, size := range imaging.Sizes {
+		if err := putEncoded(ctx, imaging.RenditionKey(key, size), res.Renditions[size]); err != nil {
+			deleteBlob(ctx, key)
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+func putEncoded(ctx context.Context, key string, enc imaging.Encoded) error {
+	return blobs.Put(ctx, key, bytes.NewReader(enc.Data), int64(len(enc.Data)), enc.ContentType)
+}
+
+// uploadStatus maps a storeUpload error to the response status.
+func uploadStatus(err error) int {
+	switch err {
+	case errUnsupportedImage:
+		return http.StatusUnsupportedMediaType
+	case errImageTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// deleteBlob removes an image that is no longer referenced, together with its
+// renditions. Failures only leave an orphan behind, so they are logged rather
+// than surfaced.
+func deleteBlob(ctx context.Context, key string) {
+	if key == "" {
+		return
+	}
+	keys := []string{key}
+	for _, size := range imaging.Sizes {
+		keys = append(keys, imaging.RenditionKey(key, size))
+	}
+	for _, k := range keys {
+		if err := blobs.Delete(ctx, k); err != nil {
+			config.Logger.Warn("Failed to delete blob", logrus.Fields{"key": k, "error": err})
+		}
+	}
+	purgeImageCache(key)
+}
+
+func blobURL(key sql.NullString) string {
+	if !key.Valid || key.String == "" {
+		return ""
+	}
+	return blobs.URL(key.String)
+}
+
+// renditionURL is the URL of one rendition of the image stored under key.
+func renditionURL(key sql.NullString, size imaging.Size) string {
+	if !key.Valid || key.String == "" {
+		return ""
+	}
+	return blobs.URL(imaging.RenditionKey(key.String, size))
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination covers both paging styles. Sending a cursor parameter, even an
+// empty one for the first page, switches the request to keyset paging over
+// (created_at, id), which stays stable while rows are being inserted.
+type pagination struct {
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Keyset   bool          `json:"keyset,omitempty"`
+	Cursor   *utils.Cursor `json:"cursor,omitempty"`
+}
+
+func parsePagination(q url.Values) (pagination, error) {
+	pg := pagination{Page: 1, PageSize: defaultPageSize}
+
+	var err error
+	if size := q.Get("page_size"); size != "" {
+		if pg.PageSize, err = strconv.Atoi(size); err != nil || pg.PageSize < 1 {
+			return pg, fmt.Errorf("invalid page_size")
+		}
+		if pg.PageSize > maxPageSize {
+			pg.PageSize = maxPageSize
+		}
+	}
+
+	if q.Has("cursor") {
+		pg.Keyset = true
+		pg.Page = 0
+		if raw := q.Get("cursor"); raw != "" {
+			c, err := utils.DecodeCursor(raw)
+			if err != nil {
+				return pg, err
+			}
+			pg.Cursor = &c
+		}
+		return pg, nil
+	}
+
+	if page := q.Get("page"); page != "" {
+		if pg.Page, err = strconv.Atoi(page); err != nil || pg.Page < 1 {
+			return pg, fmt.Errorf("invalid page")
+		}
+	}
+	return pg, nil
+}
+
+func (pg pagination) offset() int {
+	return (pg.Page - 1) * pg.PageSize
+}
+
+// keysetCond restricts the query to rows after (or before) the cursor.
+func (pg pagination) keysetCond(qb *queryBuilder, createdCol, idCol string) {
+	if pg.Cursor == nil {
+		return
+	}
+	op := "<"
+	if pg.Cursor.Backward {
+		op = ">"
+	}
+	qb.cond(fmt.Sprintf("(%s, %s) %s (%s::timestamp, %s::int)",
+		createdCol, idCol, op, qb.arg(pg.Cursor.CreatedAt), qb.arg(pg.Cursor.ID)))
+}
+
+func (pg pagination) keysetOrder(createdCol, idCol string) string {
+	if pg.Cursor != nil && pg.Cursor.Backward {
+		return createdCol + " ASC, " + idCol + " ASC"
+	}
+	return createdCol + " DESC, " + idCol + " DESC"
+}
+
+// limit returns the LIMIT/OFFSET clause. Keyset pages fetch one extra row to
+// find out whether another page follows.
+func (pg pagination) limit(qb *queryBuilder) string {
+	if pg.Keyset {
+		return " LIMIT " + qb.arg(pg.PageSize+1)
+	}
+	return " LIMIT " + qb.arg(pg.PageSize) + " OFFSET " + qb.arg(pg.offset())
+}
+
+// keysetPage trims the look-ahead row, restores newest-first order for
+// backward pages and works out the cursors for the neighbouring pages.
+func keysetPage[T any](pg pagination, items []T, key func(T) utils.Cursor) ([]T, string, string) {
+	if !pg.Keyset {
+		return items, "", ""
+	}
+
+	hasMore := len(items) > pg.PageSize
+	if hasMore {
+		items = items[:pg.PageSize]
+	}
+
+	backward := pg.Cursor != nil && pg.Cursor.Backward
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, "", ""
+	}
+
+	var next, prev string
+	if hasMore || backward {
+		c := key(items[len(items)-1])
+		next = utils.EncodeCursor(c)
+	}
+	if (pg.Cursor != nil && !backward) || (backward && hasMore) {
+		c := key(items[0])
+		c.Backward = true
+		prev = utils.EncodeCursor(c)
+	}
+	return items, next, prev
+}
+
+func paginatedResponse(pg pagination, items interface{}, total int64, next, prev string) utils.PaginatedResponse {
+	resp := utils.NewPaginatedResponse(items, total, pg.Page, pg.PageSize)
+	resp.NextCursor = next
+	resp.PrevCursor = prev
+	return resp
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+// The rules below are the single place where handlers decide who may touch
+// what. Handlers look up the row owner and ask the policy; they never compare
+// roles themselves.
+
+func currentPrincipal(w http.ResponseWriter, r *http.Request) (middleware.Principal, bool) {
+	p, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+	return p, ok
+}
+
+func isAdmin(p middleware.Principal) bool {
+	return p.Role == models.RoleAdmin
+}
+
+func canManageUser(p middleware.Principal, userID int) bool {
+	return isAdmin(p) || p.UserID == userID
+}
+
+// canAssignRole decides whether a user's role may change from from to to.
+// Roles are up to admins, except that buyers may turn themselves into owners
+// to list their own property. Sending the current role back is no change.
+func canAssignRole(p middleware.Principal, from, to string) bool {
+	if !models.IsValidRole(to) {
+		return false
+	}
+	return from == to || isAdmin(p) || (from == models.RoleBuyer && to == models.RoleOwner)
+}
+
+func canCreateProperty(p middleware.Principal) bool {
+	return p.Role == models.RoleOwner || p.Role == models.RoleAgent || isAdmin(p)
+}
+
+func canManageProperty(p middleware.Principal, ownerID int) bool {
+	return isAdmin(p) || p.UserID == ownerID
+}
+
+// canViewProperty hides listings that are not published from everyone but
+// their owner and admins.
+func canViewProperty(p middleware.Principal, ownerID int, status string) bool {
+	return status == models.StatusPublished || canManageProperty(p, ownerID)
+}
+
+func canListAllAppointments(p middleware.Principal) bool {
+	return isAdmin(p)
+}
+
+// canManageAppointment covers rescheduling, cancelling and deleting a visit,
+// which is up to the user who booked it.
+func canManageAppointment(p middleware.Principal, bookerID int) bool {
+	return isAdmin(p) || p.UserID == bookerID
+}
+
+// canRespondToAppointment covers confirming, declining and closing a visit,
+// which is up to the owner of the property visited.
+func canRespondToAppointment(p middleware.Principal, ownerID int) bool {
+	return canManageProperty(p, ownerID)
+}
+
+func canViewAppointment(p middleware.Principal, bookerID, ownerID int) bool {
+	return canManageAppointment(p, bookerID) || canRespondToAppointment(p, ownerID)
+}
+
+func propertyOwner(propertyID int) (int, error) {
+	var ownerID int
+	err := db.QueryRow("SELECT user_id FROM properties WHERE property_id = $1", propertyID).Scan(&ownerID)
+	return ownerID, err
+}
+
+// authorizeProperty writes the error response and returns false when the
+// property does not exist or the caller may not manage it.
+func authorizeProperty(w http.ResponseWriter, p middleware.Principal, propertyID int) bool {
+	ownerID, err := propertyOwner(propertyID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No property found with the given ID", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !canManageProperty(p, ownerID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizePropertyView is the read-only counterpart of authorizeProperty.
+// Hidden listings get a 404 so their existence does not leak.
+func authorizePropertyView(w http.ResponseWriter, p middleware.Principal, propertyID int) bool {
+	var ownerID int
+	var status string
+	err := db.QueryRow("SELECT user_id, status FROM properties WHERE property_id = $1", propertyID).Scan(&ownerID, &status)
+	if err == nil && !canViewProperty(p, ownerID, status) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "No property found with the given ID", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// authorizeAppointment is the appointment counterpart of authorizeProperty.
+func authorizeAppointment(w http.ResponseWriter, p middleware.Principal, appointmentID int) bool {
+	var bookerID int
+	err := db.QueryRow("SELECT user_id FROM appointments WHERE appointment_id = $1", appointmentID).Scan(&bookerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !canManageAppointment(p, bookerID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeAppointmentView lets both parties of a visit, the booker and the
+// property owner, read it.
+func authorizeAppointmentView(w http.ResponseWriter, p middleware.Principal, appointmentID int) bool {
+	var bookerID, ownerID int
+	err := db.QueryRow(`SELECT a.user_id, p.user_id
+		FROM appointments a JOIN properties p ON p.property_id = a.property_id
+		WHERE a.appointment_id = $1`, appointmentID).Scan(&bookerID, &ownerID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No appointment found with the given ID", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !canViewAppointment(p, bookerID, ownerID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+func TestCanAssignRole(t *testing.T) {
+	self := middleware.Principal{UserID: 7, Role: models.RoleBuyer}
+	admin := middleware.Principal{UserID: 1, Role: models.RoleAdmin}
+
+	tests := []struct {
+		name     string
+		p        middleware.Principal
+		from, to string
+		want     bool
+	}{
+		{"unchanged role", self, models.RoleAgent, models.RoleAgent, true},
+		{"buyer becomes owner", self, models.RoleBuyer, models.RoleOwner, true},
+		{"buyer cannot become agent", self, models.RoleBuyer, models.RoleAgent, false},
+		{"buyer cannot become admin", self, models.RoleBuyer, models.RoleAdmin, false},
+		{"owner cannot become agent", self, models.RoleOwner, models.RoleAgent, false},
+		{"admin assigns any role", admin, models.RoleBuyer, models.RoleAgent, true},
+		{"unknown role", admin, models.RoleBuyer, "landlord", false},
+	}
+	for _, tt := range tests {
+		if got := canAssignRole(tt.p, tt.from, tt.to); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
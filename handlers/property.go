@@ -4,15 +4,17 @@ import (
 
 	//"context"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
 	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -36,12 +38,32 @@ func PropertyHandler(w http.ResponseWriter, r *http.Request) {
 
 }
 
+type propertyListItem struct {
+	Property   models.Property `json:"property"`
+	UserName   string          `json:"user_name"`
+	UserEmail  string          `json:"user_email"`
+	Rank       float64         `json:"rank,omitempty"`
+	Highlight  string          `json:"highlight,omitempty"`
+	DistanceKm *float64        `json:"distance_km,omitempty"`
+	createdAt  time.Time
+}
+
 func viewProperties(w http.ResponseWriter, r *http.Request) {
-	//ctx := context.Background()
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := parsePropertyFilter(r.URL.Query(), principal)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	config.Logger.Info("Checking Redis cache for properties")
 
-	cachedProperties, err := config.RedisClient.Get("properties").Result()
+	cacheKey := propertyCacheKey(filter.cacheKey())
+	cachedProperties, err := config.RedisClient.Get(cacheKey).Result()
 	if err == nil {
 		config.Logger.Info("Serving properties from Redis cache")
 		w.Header().Set("Content-Type", "application/json")
@@ -51,11 +73,28 @@ func viewProperties(w http.ResponseWriter, r *http.Request) {
 
 	config.Logger.Warn("Cache miss, fectcing properties from database")
 
-	rows, err := db.Query(`SELECT  
-        p.property_id, p.type, p.p_address, p.prize, p.map_link, p.img_path, p.user_id,
-        u.name, u.email
+	var qb queryBuilder
+	where, exprs := filter.where(&qb)
+
+	var total int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM properties p`+where, qb.args...).Scan(&total); err != nil {
+		config.Logger.Error("Failed to count properties", logrus.Fields{"error": err})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The cursor only narrows the page, it must not affect total_items.
+	filter.keysetCond(&qb, "p.created_at", "p.property_id")
+
+	query := `SELECT
+        p.property_id, p.type, p.p_address, p.description, p.prize, ` + propertyListingColumns + `, p.map_link, p.latitude, p.longitude,
+        p.img_key, p.user_id, p.created_at, p.status, p.published_at, p.under_offer_at, p.sold_at, p.archived_at,
+        ` + propertyAttributeColumns + `, ` + favoriteCountColumn + `, u.name, u.email, ` + searchColumns(exprs) + `
         FROM properties p
-        JOIN users u ON p.user_id = u.user_id`)
+        JOIN users u ON p.user_id = u.user_id` + qb.whereClause() +
+		` ORDER BY ` + filter.orderBy() + filter.limit(&qb)
+
+	rows, err := db.Query(query, qb.args...)
 	if err != nil {
 		config.Logger.Error("Failed to fetch properties from database", logrus.Fields{"error": err})
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -63,44 +102,82 @@ func viewProperties(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var properties []struct {
-		Property  models.Property `json:"property"`
-		UserName  string          `json:"user_name"`
-		UserEmail string          `json:"user_email"`
-	}
+	properties := []propertyListItem{}
 
 	for rows.Next() {
 		var property models.Property
-		var imageData []byte
-		var userName, userEmail string
-
-		if err := rows.Scan(&property.PropertyID, &property.Type, &property.PAddress, &property.Prize, &property.MapLink, &imageData, &property.UserID,
-			&userName, &userEmail); err != nil {
+		var imgKey sql.NullString
+		var userName, userEmail, highlight string
+		var description sql.NullString
+		var lat, lng, distance sql.NullFloat64
+		var rank float64
+		var createdAt time.Time
+		var publishedAt, underOfferAt, soldAt, archivedAt sql.NullTime
+		var attrs attributeScan
+		var terms listingScan
+
+		dest := []interface{}{&property.PropertyID, &property.Type, &property.PAddress, &description, &property.Prize}
+		dest = append(dest, terms.dest(&property)...)
+		dest = append(dest, &property.MapLink, &lat, &lng,
+			&imgKey, &property.UserID, &createdAt, &property.Status, &publishedAt, &underOfferAt, &soldAt, &archivedAt)
+		dest = append(dest, attrs.dest(&property)...)
+		dest = append(dest, &property.FavoriteCount, &userName, &userEmail, &rank, &highlight, &distance)
+		if err := rows.Scan(dest...); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		property.Img = base64.StdEncoding.EncodeToString(imageData)
-
-		properties = append(properties, struct {
-			Property  models.Property `json:"property"`
-			UserName  string          `json:"user_name"`
-			UserEmail string          `json:"user_email"`
-		}{
-			Property:  property,
-			UserName:  userName,
-			UserEmail: userEmail,
+		attrs.apply(&property)
+		terms.apply(&property)
+
+		property.ImgURL = blobURL(imgKey)
+		property.ThumbURL = renditionURL(imgKey, imaging.Thumb)
+		property.Description = description.String
+		property.Latitude = nullFloat(lat)
+		property.Longitude = nullFloat(lng)
+		property.CreatedAt = createdAt.Format(time.RFC3339)
+		property.PublishedAt = nullTime(publishedAt)
+		property.UnderOfferAt = nullTime(underOfferAt)
+		property.SoldAt = nullTime(soldAt)
+		property.ArchivedAt = nullTime(archivedAt)
+
+		properties = append(properties, propertyListItem{
+			Property:   property,
+			UserName:   userName,
+			UserEmail:  userEmail,
+			Rank:       rank,
+			Highlight:  highlight,
+			DistanceKm: nullFloat(distance),
+			createdAt:  createdAt,
 		})
 	}
 
-	jsonData, _ := json.Marshal(properties)
+	properties, next, prev := keysetPage(filter.pagination, properties, func(item propertyListItem) utils.Cursor {
+		return utils.Cursor{CreatedAt: item.createdAt, ID: item.Property.PropertyID}
+	})
+
+	ids := make([]int, len(properties))
+	for i, item := range properties {
+		ids[i] = item.Property.PropertyID
+	}
+	galleries, err := loadPropertyImages(ids...)
+	if err != nil {
+		config.Logger.Error("Failed to fetch property images", logrus.Fields{"error": err})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range properties {
+		properties[i].Property.Images = thumbnailsOnly(galleries[properties[i].Property.PropertyID])
+	}
+
+	jsonData, err := json.Marshal(paginatedResponse(filter.pagination, properties, total, next, prev))
 	if err != nil {
 		http.Error(w, "Failed to encode properties", http.StatusInternalServerError)
 		return
 	}
 
 	config.Logger.Info("Successfully fetched properties from database, caching in Redis")
-	config.RedisClient.Set("properties", string(jsonData), 10*time.Minute)
+	config.RedisClient.Set(cacheKey, string(jsonData), 10*time.Minute)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(jsonData)
@@ -108,7 +185,29 @@ func viewProperties(w http.ResponseWriter, r *http.Request) {
 	config.Logger.Info("Response sent successfully for properties")
 }
 
+// Cached pages are keyed by a generation counter. Bumping it on every write
+// invalidates all cached searches at once without scanning the keyspace.
+func propertyCacheKey(filterKey string) string {
+	gen, _ := config.RedisClient.Get("properties:gen").Int64()
+	return fmt.Sprintf("properties:%d:%s", gen, filterKey)
+}
+
+func invalidatePropertyCache() {
+	if err := config.RedisClient.Incr("properties:gen").Err(); err != nil {
+		config.Logger.Warn("Failed to invalidate property cache", logrus.Fields{"error": err})
+	}
+}
+
 func addProperty(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !canCreateProperty(principal) {
+		http.Error(w, "Only owners, agents and admins can list properties", http.StatusForbidden)
+		return
+	}
+
 	var p models.Property
 	err := json.NewDecoder(r.Body).Decode(&p)
 	if err != nil {
@@ -116,23 +215,78 @@ func addProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The owner comes from the token; only admins may list on someone's behalf.
+	if !isAdmin(principal) || p.UserID == 0 {
+		p.UserID = principal.UserID
+	}
+
+	if err := resolveCoordinates(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateAttributes(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateListingTerms(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// New listings start as drafts unless they are published right away.
+	switch p.Status {
+	case "":
+		p.Status = models.StatusDraft
+	case models.StatusDraft, models.StatusPublished:
+	default:
+		http.Error(w, "New properties must be draft or published", http.StatusBadRequest)
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	stmt, err := db.Prepare("INSERT INTO properties(user_id, type, p_address, prize, map_link, img) VALUES($1, $2, $3, $4, $5, $6) RETURNING property_id")
-
+	tx, err := db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
-
-	err = stmt.QueryRow(p.UserID, p.Type, p.PAddress, p.Prize, p.MapLink, p.Img).Scan(&p.PropertyID)
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO properties(user_id, type, p_address, description, prize, map_link, latitude, longitude, status, published_at,
+			bedrooms, bathrooms, carpet_area, built_up_area, area_unit, floor, total_floors, facing, furnishing, parking, year_built,
+			listing_kind, monthly_rent, security_deposit, maintenance, min_lease_months, available_from)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, CASE WHEN $9::text = 'published' THEN CURRENT_TIMESTAMP END,
+			$10, $11, $12, $13, $14, $15, $16, NULLIF($17, ''), NULLIF($18, ''), $19, $20,
+			$21, $22, $23, $24, $25, NULLIF($26, '')::date) RETURNING property_id`,
+		p.UserID, p.Type, p.PAddress, p.Description, p.Prize, p.MapLink, p.Latitude, p.Longitude, p.Status,
+		p.Bedrooms, p.Bathrooms, p.CarpetArea, p.BuiltUpArea, p.AreaUnit, p.Floor, p.TotalFloors, p.Facing, p.Furnishing, p.Parking, p.YearBuilt,
+		p.ListingKind, p.MonthlyRent, p.SecurityDeposit, p.Maintenance, p.MinLeaseMonths, p.AvailableFrom).
+		Scan(&p.PropertyID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if err := setPropertyAmenities(tx, p.PropertyID, p.Amenities); err != nil {
+		writeAmenityError(w, err)
+		return
+	}
+	if err := recordPrice(tx, p.PropertyID, principal.UserID, "", 0, &p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePropertyCache()
+	if p.Status == models.StatusPublished {
+		queueAlertMatch(p.PropertyID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
 }
@@ -153,17 +307,62 @@ func updateProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := resolveCoordinates(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateAttributes(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateListingTerms(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	stmt, err := db.Prepare("UPDATE properties SET type=$1, p_address=$2, prize=$3, map_link=$4, img=$5 WHERE property_id=$6")
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var prevKind string
+	var prevPrice float64
+	err = tx.QueryRow(`SELECT p.listing_kind, `+askingPriceExpr+` FROM properties p
+		WHERE p.property_id = $1 FOR UPDATE`, propertyID).Scan(&prevKind, &prevPrice)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No property found with the given ID", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
 
-	result, err := stmt.Exec(p.Type, p.PAddress, p.Prize, p.MapLink, p.Img, propertyID)
+	result, err := tx.Exec(`UPDATE properties
+		SET type=$1, p_address=$2, description=$3, prize=$4, map_link=$5, latitude=$6, longitude=$7,
+			bedrooms=$8, bathrooms=$9, carpet_area=$10, built_up_area=$11, area_unit=$12, floor=$13, total_floors=$14,
+			facing=NULLIF($15, ''), furnishing=NULLIF($16, ''), parking=$17, year_built=$18,
+			listing_kind=$19, monthly_rent=$20, security_deposit=$21, maintenance=$22, min_lease_months=$23,
+			available_from=NULLIF($24, '')::date
+		WHERE property_id=$25`,
+		p.Type, p.PAddress, p.Description, p.Prize, p.MapLink, p.Latitude, p.Longitude,
+		p.Bedrooms, p.Bathrooms, p.CarpetArea, p.BuiltUpArea, p.AreaUnit, p.Floor, p.TotalFloors,
+		p.Facing, p.Furnishing, p.Parking, p.YearBuilt,
+		p.ListingKind, p.MonthlyRent, p.SecurityDeposit, p.Maintenance, p.MinLeaseMonths, p.AvailableFrom, propertyID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -179,6 +378,26 @@ func updateProperty(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No property found with the given ID", http.StatusNotFound)
 		return
 	}
+
+	if err := recordPrice(tx, propertyID, principal.UserID, prevKind, prevPrice, &p); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Amenities are only replaced when the payload includes them.
+	if p.Amenities != nil {
+		if err := setPropertyAmenities(tx, propertyID, p.Amenities); err != nil {
+			writeAmenityError(w, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePropertyCache()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Property updated successfully"})
 }
@@ -192,9 +411,24 @@ func deleteProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	blobKeys, err := propertyBlobKeys(propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	stmt, err := db.Prepare("DELETE FROM properties WHERE property_id = $1")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -219,6 +453,44 @@ func deleteProperty(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, key := range blobKeys {
+		deleteBlob(r.Context(), key)
+	}
+	invalidatePropertyCache()
+
 	w.WriteHeader(http.StatusNoContent)
 
 }
+
+// resolveCoordinates fills in latitude/longitude from the map link when the
+// client did not send them explicitly.
+func resolveCoordinates(p *models.Property) error {
+	if (p.Latitude == nil) != (p.Longitude == nil) {
+		return fmt.Errorf("latitude and longitude must be sent together")
+	}
+	if p.Latitude != nil {
+		if !utils.ValidLatLng(*p.Latitude, *p.Longitude) {
+			return utils.ErrInvalidLatLng
+		}
+		return nil
+	}
+
+	if point, ok := utils.ParseMapLink(p.MapLink); ok {
+		p.Latitude, p.Longitude = &point.Lat, &point.Lng
+	}
+	return nil
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
+
+func nullTime(v sql.NullTime) string {
+	if !v.Valid {
+		return ""
+	}
+	return v.Time.Format(time.RFC3339)
+}
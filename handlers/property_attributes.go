@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+var errUnknownAmenity = errors.New("unknown amenity, see GET /amenities")
+
+// propertyAttributeFilter holds the GET /property filters on structured
+// listing attributes. Areas are compared in square feet.
+type propertyAttributeFilter struct {
+	Bedrooms     []int    `json:"bedrooms,omitempty"`
+	MinBedrooms  *int     `json:"min_bedrooms,omitempty"`
+	MinBathrooms *int     `json:"min_bathrooms,omitempty"`
+	MinAreaSqft  *float64 `json:"min_area_sqft,omitempty"`
+	MaxAreaSqft  *float64 `json:"max_area_sqft,omitempty"`
+	Furnishing   []string `json:"furnishing,omitempty"`
+	Facing       []string `json:"facing,omitempty"`
+	MinParking   *int     `json:"min_parking,omitempty"`
+	MinFloor     *int     `json:"min_floor,omitempty"`
+	MaxFloor     *int     `json:"max_floor,omitempty"`
+	MinYearBuilt *int     `json:"min_year_built,omitempty"`
+	Amenities    []string `json:"amenities,omitempty"`
+}
+
+func parseAttributeFilter(q url.Values) (propertyAttributeFilter, error) {
+	var f propertyAttributeFilter
+	var err error
+
+	if raw := q.Get("bedrooms"); raw != "" {
+		for _, s := range strings.Split(raw, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || n < 0 {
+				return f, fmt.Errorf("invalid bedrooms, expected a comma separated list of numbers")
+			}
+			f.Bedrooms = append(f.Bedrooms, n)
+		}
+		sort.Ints(f.Bedrooms)
+	}
+
+	// Basements are negative floors, every other count starts at zero.
+	for _, p := range []struct {
+		key string
+		dst **int
+		min int
+	}{
+		{"min_bedrooms", &f.MinBedrooms, 0},
+		{"min_bathrooms", &f.MinBathrooms, 0},
+		{"min_parking", &f.MinParking, 0},
+		{"min_floor", &f.MinFloor, -10},
+		{"max_floor", &f.MaxFloor, -10},
+		{"min_year_built", &f.MinYearBuilt, 0},
+	} {
+		if *p.dst, err = parseOptionalInt(q, p.key, p.min); err != nil {
+			return f, err
+		}
+	}
+
+	unit := q.Get("area_unit")
+	if unit == "" {
+		unit = "sqft"
+	}
+	factor, ok := models.AreaUnits[unit]
+	if !ok {
+		return f, fmt.Errorf("invalid area_unit, expected sqft, sqm or sqyd")
+	}
+	if f.MinAreaSqft, err = parseOptionalFloat(q, "min_area"); err != nil {
+		return f, err
+	}
+	if f.MaxAreaSqft, err = parseOptionalFloat(q, "max_area"); err != nil {
+		return f, err
+	}
+	for _, v := range []*float64{f.MinAreaSqft, f.MaxAreaSqft} {
+		if v != nil {
+			*v *= factor
+		}
+	}
+
+	if f.Furnishing, err = parseEnumList(q, "furnishing", models.Furnishings); err != nil {
+		return f, err
+	}
+	if f.Facing, err = parseEnumList(q, "facing", models.Facings); err != nil {
+		return f, err
+	}
+	if raw := q.Get("amenities"); raw != "" {
+		f.Amenities = normalizeSlugs(strings.Split(raw, ","))
+	}
+	return f, nil
+}
+
+func parseOptionalInt(q url.Values, key string, min int) (*int, error) {
+	raw := q.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < min {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	return &v, nil
+}
+
+func parseEnumList(q url.Values, key string, valid map[string]bool) ([]string, error) {
+	raw := q.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	values := normalizeSlugs(strings.Split(raw, ","))
+	for _, v := range values {
+		if !valid[v] {
+			return nil, fmt.Errorf("invalid %s %q", key, v)
+		}
+	}
+	return values, nil
+}
+
+// normalizeSlugs trims, lowercases, sorts and de-duplicates slugs so
+// equivalent filters share a cache entry.
+func normalizeSlugs(raw []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range raw {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s != "" && !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (f propertyAttributeFilter) where(qb *queryBuilder) {
+	if len(f.Bedrooms) > 0 {
+		qb.cond("p.bedrooms = ANY(" + qb.arg(pq.Array(f.Bedrooms)) + ")")
+	}
+	if f.MinBedrooms != nil {
+		qb.cond("p.bedrooms >= " + qb.arg(*f.MinBedrooms))
+	}
+	if f.MinBathrooms != nil {
+		qb.cond("p.bathrooms >= " + qb.arg(*f.MinBathrooms))
+	}
+	if f.MinAreaSqft != nil {
+		qb.cond("p.area_sqft >= " + qb.arg(*f.MinAreaSqft))
+	}
+	if f.MaxAreaSqft != nil {
+		qb.cond("p.area_sqft <= " + qb.arg(*f.MaxAreaSqft))
+	}
+	if len(f.Furnishing) > 0 {
+		qb.cond("p.furnishing = ANY(" + qb.arg(pq.Array(f.Furnishing)) + ")")
+	}
+	if len(f.Facing) > 0 {
+		qb.cond("p.facing = ANY(" + qb.arg(pq.Array(f.Facing)) + ")")
+	}
+	if f.MinParking != nil {
+		qb.cond("p.parking >= " + qb.arg(*f.MinParking))
+	}
+	if f.MinFloor != nil {
+		qb.cond("p.floor >= " + qb.arg(*f.MinFloor))
+	}
+	if f.MaxFloor != nil {
+		qb.cond("p.floor <= " + qb.arg(*f.MaxFloor))
+	}
+	if f.MinYearBuilt != nil {
+		qb.cond("p.year_built >= " + qb.arg(*f.MinYearBuilt))
+	}
+	if len(f.Amenities) > 0 {
+		// Listings must offer every requested amenity, not just one of them.
+		qb.cond(`p.property_id IN (SELECT pa.property_id FROM property_amenities pa
+			JOIN amenities a ON a.amenity_id = pa.amenity_id
+			WHERE a.slug = ANY(` + qb.arg(pq.Array(f.Amenities)) + `)
+			GROUP BY pa.property_id HAVING COUNT(*) = ` + qb.arg(len(f.Amenities)) + `)`)
+	}
+}
+
+// validateAttributes checks the structured attributes of a property payload
+// and fills in the default area unit.
+func validateAttributes(p *models.Property) error {
+	for name, v := range map[string]*int{"bedrooms": p.Bedrooms, "bathrooms": p.Bathrooms, "parking": p.Parking, "total_floors": p.TotalFloors} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	for name, v := range map[string]*float64{"carpet_area": p.CarpetArea, "built_up_area": p.BuiltUpArea} {
+		if v != nil && *v <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	if p.CarpetArea != nil && p.BuiltUpArea != nil && *p.CarpetArea > *p.BuiltUpArea {
+		return fmt.Errorf("carpet_area cannot exceed built_up_area")
+	}
+	if p.Floor != nil && p.TotalFloors != nil && *p.Floor > *p.TotalFloors {
+		return fmt.Errorf("floor cannot be above total_floors")
+	}
+	if p.YearBuilt != nil && (*p.YearBuilt < 1800 || *p.YearBuilt > time.Now().Year()+5) {
+		return fmt.Errorf("invalid year_built")
+	}
+
+	if p.AreaUnit == "" {
+		p.AreaUnit = "sqft"
+	}
+	if _, ok := models.AreaUnits[p.AreaUnit]; !ok {
+		return fmt.Errorf("invalid area_unit, expected sqft, sqm or sqyd")
+	}
+	if p.Facing != "" && !models.Facings[p.Facing] {
+		return fmt.Errorf("invalid facing")
+	}
+	if p.Furnishing != "" && !models.Furnishings[p.Furnishing] {
+		return fmt.Errorf("invalid furnishing, expected unfurnished, semi_furnished or furnished")
+	}
+	if p.Amenities != nil {
+		p.Amenities = normalizeSlugs(p.Amenities)
+		if p.Amenities == nil {
+			p.Amenities = []string{}
+		}
+	}
+	return nil
+}
+
+// setPropertyAmenities replaces the amenities of a property. Slugs missing
+// from the catalog fail with errUnknownAmenity.
+func setPropertyAmenities(tx *sql.Tx, propertyID int, slugs []string) error {
+	if _, err := tx.Exec("DELETE FROM property_amenities WHERE property_id = $1", propertyID); err != nil {
+		return err
+	}
+	if len(slugs) == 0 {
+		return nil
+	}
+	res, err := tx.Exec(`INSERT INTO property_amenities (property_id, amenity_id)
+		SELECT $1, amenity_id FROM amenities WHERE slug = ANY($2)`, propertyID, pq.Array(slugs))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != int64(len(slugs)) {
+		return errUnknownAmenity
+	}
+	return nil
+}
+
+func writeAmenityError(w http.ResponseWriter, err error) {
+	if err == errUnknownAmenity {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// AmenitiesHandler serves the amenities catalog: everyone can list it
+// (GET /amenities), admins can extend it (POST /amenities).
+func AmenitiesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewAmenities(w, r)
+	case "POST":
+		addAmenity(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewAmenities(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query("SELECT slug, name FROM amenities ORDER BY name")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	amenities := []models.Amenity{}
+	for rows.Next() {
+		var a models.Amenity
+		if err := rows.Scan(&a.Slug, &a.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		amenities = append(amenities, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(amenities)
+}
+
+func addAmenity(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !isAdmin(principal) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var a models.Amenity
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slugs := normalizeSlugs([]string{a.Slug})
+	if len(slugs) == 0 || strings.TrimSpace(a.Name) == "" {
+		http.Error(w, "slug and name are required", http.StatusBadRequest)
+		return
+	}
+	a.Slug, a.Name = slugs[0], strings.TrimSpace(a.Name)
+
+	res, err := db.Exec("INSERT INTO amenities (slug, name) VALUES ($1, $2) ON CONFLICT (slug) DO NOTHING", a.Slug, a.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Amenity already exists", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// propertyAttributeColumns selects the structured attributes of p; scan them
+// with an attributeScan.
+const propertyAttributeColumns = `p.bedrooms, p.bathrooms, p.carpet_area, p.built_up_area, p.area_unit,
+	p.floor, p.total_floors, COALESCE(p.facing, ''), COALESCE(p.furnishing, ''), p.parking, p.year_built,
+	ARRAY(SELECT a.slug FROM property_amenities pa JOIN amenities a ON a.amenity_id = pa.amenity_id
+		WHERE pa.property_id = p.property_id ORDER BY a.slug)`
+
+type attributeScan struct {
+	bedrooms, bathrooms, floor, totalFloors, parking, yearBuilt sql.NullInt64
+	carpetArea, builtUpArea                                     sql.NullFloat64
+	amenities                                                   pq.StringArray
+}
+
+func (s *attributeScan) dest(p *models.Property) []interface{} {
+	return []interface{}{&s.bedrooms, &s.bathrooms, &s.carpetArea, &s.builtUpArea, &p.AreaUnit,
+		&s.floor, &s.totalFloors, &p.Facing, &p.Furnishing, &s.parking, &s.yearBuilt, &s.amenities}
+}
+
+func (s *attributeScan) apply(p *models.Property) {
+	p.Bedrooms = nullInt(s.bedrooms)
+	p.Bathrooms = nullInt(s.bathrooms)
+	p.CarpetArea = nullFloat(s.carpetArea)
+	p.BuiltUpArea = nullFloat(s.builtUpArea)
+	p.Floor = nullInt(s.floor)
+	p.TotalFloors = nullInt(s.totalFloors)
+	p.Parking = nullInt(s.parking)
+	p.YearBuilt = nullInt(s.yearBuilt)
+	p.Amenities = []string(s.amenities)
+}
+
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
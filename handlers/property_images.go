@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxGalleryImages  = 30
+	maxGalleryRequest = 64 << 20
+)
+
+// PropertyImagesHandler serves the gallery of a property:
+// GET/POST /property/{id}/images and DELETE /property/{id}/images/{image_id}.
+func PropertyImagesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewPropertyImages(w, r)
+	case "POST":
+		addPropertyImages(w, r)
+	case "DELETE":
+		deletePropertyImage(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewPropertyImages(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	images, err := loadPropertyImages(propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gallery := images[propertyID]
+	if gallery == nil {
+		gallery = []models.PropertyImage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gallery)
+}
+
+// addPropertyImages appends every file of the "images" form field to the end
+// of the gallery. The first image of an empty gallery becomes the cover.
+func addPropertyImages(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxGalleryRequest)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Upload too large or invalid form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		http.Error(w, "No files in images field", http.StatusBadRequest)
+		return
+	}
+	if len(files) > maxGalleryImages {
+		http.Error(w, fmt.Sprintf("At most %d images per property", maxGalleryImages), http.StatusBadRequest)
+		return
+	}
+	for _, header := range files {
+		if header.Size > maxImageUpload {
+			http.Error(w, "Image too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	prefix := "properties/" + strconv.Itoa(propertyID)
+	var keys []string
+	discard := func() {
+		for _, key := range keys {
+			deleteBlob(r.Context(), key)
+		}
+	}
+	for _, header := range files {
+		key, err := storeFileHeader(r, prefix, header)
+		if err != nil {
+			discard()
+			if status := uploadStatus(err); status != http.StatusInternalServerError {
+				http.Error(w, header.Filename+": "+err.Error(), status)
+				return
+			}
+			config.Logger.Error("Failed to store property image", logrus.Fields{"error": err})
+			http.Error(w, "Failed to store image", http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, key)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	status, err := insertPropertyImages(propertyID, keys)
+	if err != nil {
+		discard()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	invalidatePropertyCache()
+
+	images, err := loadPropertyImages(propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(images[propertyID])
+}
+
+func storeFileHeader(r *http.Request, prefix string, header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return storeUpload(r.Context(), prefix, file, header)
+}
+
+// insertPropertyImages adds keys to the gallery in one transaction. It returns
+// the HTTP status to use when it fails.
+func insertPropertyImages(propertyID int, keys []string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+
+	// Locking the property serialises concurrent uploads to the same gallery.
+	if _, err := tx.Exec("SELECT 1 FROM properties WHERE property_id = $1 FOR UPDATE", propertyID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	var count, next int
+	var hasCover bool
+	err = tx.QueryRow(`SELECT COUNT(*), COALESCE(MAX(position) + 1, 0), COALESCE(bool_or(is_cover), FALSE)
+		FROM property_images WHERE property_id = $1`, propertyID).Scan(&count, &next, &hasCover)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if count+len(keys) > maxGalleryImages {
+		return http.StatusConflict, fmt.Errorf("at most %d images per property", maxGalleryImages)
+	}
+
+	for i, key := range keys {
+		isCover := !hasCover && i == 0
+		if _, err := tx.Exec(`INSERT INTO property_images (property_id, blob_key, position, is_cover)
+			VALUES ($1, $2, $3, $4)`, propertyID, key, next+i, isCover); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if err := syncCover(tx, propertyID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusCreated, nil
+}
+
+// deletePropertyImage removes one image. When it was the cover, the first
+// remaining image takes over.
+func deletePropertyImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	propertyID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	imageID, err := strconv.Atoi(vars["image_id"])
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var key string
+	var wasCover bool
+	err = tx.QueryRow(`DELETE FROM property_images WHERE image_id = $1 AND property_id = $2
+		RETURNING blob_key, is_cover`, imageID, propertyID).Scan(&key, &wasCover)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No image found with the given ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wasCover {
+		_, err = tx.Exec(`UPDATE property_images SET is_cover = TRUE WHERE image_id = (
+			SELECT image_id FROM property_images WHERE property_id = $1 ORDER BY position, image_id LIMIT 1)`, propertyID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := syncCover(tx, propertyID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deleteBlob(r.Context(), key)
+	invalidatePropertyCache()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type imageOrderRequest struct {
+	ImageIDs []int `json:"image_ids"`
+}
+
+// PropertyImageOrderHandler reorders a gallery (PUT /property/{id}/images/order).
+// The body must list every image of the property exactly once.
+func PropertyImageOrderHandler(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	var req imageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT image_id FROM property_images WHERE property_id = $1 FOR UPDATE", propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	current := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		current[id] = true
+	}
+	rows.Close()
+
+	if !samePermutation(current, req.ImageIDs) {
+		http.Error(w, "image_ids must list every image of the property exactly once", http.StatusBadRequest)
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE property_images i SET position = o.ord - 1
+		FROM unnest($2::int[]) WITH ORDINALITY AS o(image_id, ord)
+		WHERE i.image_id = o.image_id AND i.property_id = $1`, propertyID, pq.Array(req.ImageIDs))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePropertyCache()
+
+	images, err := loadPropertyImages(propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(images[propertyID])
+}
+
+func samePermutation(current map[int]bool, ids []int) bool {
+	if len(ids) != len(current) {
+		return false
+	}
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if !current[id] || seen[id] {
+			return false
+		}
+		seen[id] = true
+	}
+	return true
+}
+
+// PropertyCoverHandler makes an image the cover of its property
+// (PUT /property/{id}/images/{image_id}/cover).
+func PropertyCoverHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	propertyID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	imageID, err := strconv.Atoi(vars["image_id"])
+	if err != nil {
+		http.Error(w, "Invalid image ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Clear the old cover first; the unique cover index is checked per row.
+	_, err = tx.Exec(`UPDATE property_images SET is_cover = FALSE
+		WHERE property_id = $1 AND is_cover AND image_id <> $2`, propertyID, imageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res, err := tx.Exec(`UPDATE property_images SET is_cover = TRUE
+		WHERE property_id = $1 AND image_id = $2`, propertyID, imageID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		http.Error(w, "No image found with the given ID", http.StatusNotFound)
+		return
+	}
+
+	if err := syncCover(tx, propertyID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePropertyCache()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cover image updated successfully"})
+}
+
+// syncCover copies the cover's key onto properties.img_key, which list
+// queries read instead of joining the gallery.
+func syncCover(tx *sql.Tx, propertyID int) error {
+	_, err := tx.Exec(`UPDATE properties SET img_key = (
+		SELECT blob_key FROM property_images WHERE property_id = $1 AND is_cover)
+		WHERE property_id = $1`, propertyID)
+	return err
+}
+
+// loadPropertyImages returns the ordered galleries of the given properties.
+func loadPropertyImages(propertyIDs ...int) (map[int][]models.PropertyImage, error) {
+	galleries := make(map[int][]models.PropertyImage, len(propertyIDs))
+	if len(propertyIDs) == 0 {
+		return galleries, nil
+	}
+
+	rows, err := db.Query(`SELECT image_id, property_id, blob_key, position, is_cover
+		FROM property_images WHERE property_id = ANY($1)
+		ORDER BY property_id, position, image_id`, pq.Array(propertyIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var img models.PropertyImage
+		var key sql.NullString
+		if err := rows.Scan(&img.ImageID, &img.PropertyID, &key, &img.Position, &img.IsCover); err != nil {
+			return nil, err
+		}
+		img.URL = blobURL(key)
+		img.ThumbURL = renditionURL(key, imaging.Thumb)
+		img.MediumURL = renditionURL(key, imaging.Medium)
+		img.LargeURL = renditionURL(key, imaging.Large)
+		galleries[img.PropertyID] = append(galleries[img.PropertyID], img)
+	}
+	return galleries, rows.Err()
+}
+
+// thumbnailsOnly trims a gallery down to what list endpoints return.
+func thumbnailsOnly(images []models.PropertyImage) []models.PropertyImage {
+	for i := range images {
+		images[i].URL, images[i].MediumURL, images[i].LargeURL = "", "", ""
+	}
+	return images
+}
+
+// propertyBlobKeys lists the gallery images and media of a property, so the
+// blobs can be removed once the property row (and with it theirs) is gone.
+func propertyBlobKeys(propertyID int) ([]string, error) {
+	rows, err := db.Query(`SELECT blob_key FROM property_images WHERE property_id = $1
+		UNION ALL SELECT blob_key FROM property_media WHERE property_id = $1`, propertyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
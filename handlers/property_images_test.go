@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestReorderRejectsIncompleteOrder(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT image_id FROM property_images").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"image_id"}).AddRow(7).AddRow(8).AddRow(9))
+	mock.ExpectRollback()
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/property/1/images/order", strings.NewReader(`{"image_ids":[9,7,7]}`)), 4, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/images/order", PropertyImageOrderHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetCoverSyncsPropertyImage(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectBegin()
+	mock.ExpectExec("SET is_cover = FALSE").
+		WithArgs(1, 8).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("SET is_cover = TRUE").
+		WithArgs(1, 8).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE properties SET img_key").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/property/1/images/8/cover", nil), 4, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/images/{image_id}/cover", PropertyCoverHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestViewPropertyImages(t *testing.T) {
+	serve := func(userID int) *httptest.ResponseRecorder {
+		req := asUser(httptest.NewRequest(http.MethodGet, "/property/1/images", nil), userID, "buyer")
+		rec := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/property/{id}/images", PropertyImagesHandler)
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	// A draft is hidden from everyone but its owner.
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(4, "draft"))
+	if rec := serve(9); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(4, "draft"))
+	mock.ExpectQuery("FROM property_images").
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "property_id", "blob_key", "position", "is_cover"}))
+	rec := serve(4)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+		t.Fatalf("expected an empty gallery, got %s", body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetCoverUnknownProperty(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(99).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	req := asUser(httptest.NewRequest(http.MethodPut, "/property/99/images/8/cover", nil), 4, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/images/{image_id}/cover", PropertyCoverHandler)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
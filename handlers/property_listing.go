@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+const dateLayout = "2006-01-02"
+
+// propertyListingFilter holds the GET /property filters on the listing kind
+// and rental terms.
+type propertyListingFilter struct {
+	ListingKinds []string `json:"listing_kind,omitempty"`
+	MinRent      *float64 `json:"min_rent,omitempty"`
+	MaxRent      *float64 `json:"max_rent,omitempty"`
+	MaxDeposit   *float64 `json:"max_deposit,omitempty"`
+	AvailableBy  string   `json:"available_by,omitempty"`
+	LeaseMonths  *int     `json:"lease_months,omitempty"`
+}
+
+func parseListingFilter(q url.Values) (propertyListingFilter, error) {
+	var f propertyListingFilter
+	var err error
+
+	if f.ListingKinds, err = parseEnumList(q, "listing_kind", models.ListingKinds); err != nil {
+		return f, err
+	}
+	if f.MinRent, err = parseOptionalFloat(q, "min_rent"); err != nil {
+		return f, err
+	}
+	if f.MaxRent, err = parseOptionalFloat(q, "max_rent"); err != nil {
+		return f, err
+	}
+	if f.MinRent != nil && f.MaxRent != nil && *f.MinRent > *f.MaxRent {
+		return f, fmt.Errorf("min_rent cannot be greater than max_rent")
+	}
+	if f.MaxDeposit, err = parseOptionalFloat(q, "max_deposit"); err != nil {
+		return f, err
+	}
+	if raw := q.Get("available_by"); raw != "" {
+		if _, err := time.Parse(dateLayout, raw); err != nil {
+			return f, fmt.Errorf("invalid available_by, expected YYYY-MM-DD")
+		}
+		f.AvailableBy = raw
+	}
+	// lease_months is how long the tenant can commit to; it matches listings
+	// whose minimum lease is no longer than that.
+	if f.LeaseMonths, err = parseOptionalInt(q, "lease_months", 1); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func (f propertyListingFilter) where(qb *queryBuilder) {
+	if len(f.ListingKinds) > 0 {
+		qb.cond("p.listing_kind = ANY(" + qb.arg(pq.Array(f.ListingKinds)) + ")")
+	}
+	if f.MinRent != nil {
+		qb.cond("p.monthly_rent >= " + qb.arg(*f.MinRent))
+	}
+	if f.MaxRent != nil {
+		qb.cond("p.monthly_rent <= " + qb.arg(*f.MaxRent))
+	}
+	if f.MaxDeposit != nil {
+		qb.cond("COALESCE(p.security_deposit, 0) <= " + qb.arg(*f.MaxDeposit))
+	}
+	if f.AvailableBy != "" {
+		qb.cond("(p.available_from IS NULL OR p.available_from <= " + qb.arg(f.AvailableBy) + ")")
+	}
+	if f.LeaseMonths != nil {
+		qb.cond("(p.min_lease_months IS NULL OR p.min_lease_months <= " + qb.arg(*f.LeaseMonths) + ")")
+	}
+}
+
+// validateListingTerms checks the listing kind of a property payload against
+// its price and rental terms, and defaults the kind to sale.
+func validateListingTerms(p *models.Property) error {
+	if p.ListingKind == "" {
+		p.ListingKind = models.ListingSale
+	}
+	if !models.ListingKinds[p.ListingKind] {
+		return fmt.Errorf("invalid listing_kind, expected sale, rent or lease")
+	}
+
+	if p.ListingKind == models.ListingSale {
+		if p.Prize <= 0 {
+			return fmt.Errorf("prize must be positive for sale listings")
+		}
+		if p.MonthlyRent != nil || p.SecurityDeposit != nil || p.Maintenance != nil || p.MinLeaseMonths != nil || p.AvailableFrom != "" {
+			return fmt.Errorf("rental terms are only allowed on rent and lease listings")
+		}
+		return nil
+	}
+
+	if p.Prize != 0 {
+		return fmt.Errorf("prize only applies to sale listings, use monthly_rent")
+	}
+	if p.MonthlyRent == nil || *p.MonthlyRent <= 0 {
+		return fmt.Errorf("monthly_rent must be positive for %s listings", p.ListingKind)
+	}
+	for name, v := range map[string]*float64{"security_deposit": p.SecurityDeposit, "maintenance": p.Maintenance} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	if p.MinLeaseMonths != nil && *p.MinLeaseMonths < 1 {
+		return fmt.Errorf("min_lease_months must be at least 1")
+	}
+	if p.ListingKind == models.ListingLease && p.MinLeaseMonths == nil {
+		return fmt.Errorf("min_lease_months is required for lease listings")
+	}
+	if p.AvailableFrom != "" {
+		if _, err := time.Parse(dateLayout, p.AvailableFrom); err != nil {
+			return fmt.Errorf("invalid available_from, expected YYYY-MM-DD")
+		}
+	}
+	return nil
+}
+
+// propertyListingColumns selects the listing kind and rental terms of p; scan
+// them with a listingScan.
+const propertyListingColumns = `p.listing_kind, p.monthly_rent, p.security_deposit, p.maintenance,
+	p.min_lease_months, p.available_from`
+
+type listingScan struct {
+	monthlyRent, securityDeposit, maintenance sql.NullFloat64
+	minLeaseMonths                            sql.NullInt64
+	availableFrom                             sql.NullTime
+}
+
+func (s *listingScan) dest(p *models.Property) []interface{} {
+	return []interface{}{&p.ListingKind, &s.monthlyRent, &s.securityDeposit, &s.maintenance,
+		&s.minLeaseMonths, &s.availableFrom}
+}
+
+func (s *listingScan) apply(p *models.Property) {
+	p.MonthlyRent = nullFloat(s.monthlyRent)
+	p.SecurityDeposit = nullFloat(s.securityDeposit)
+	p.Maintenance = nullFloat(s.maintenance)
+	p.MinLeaseMonths = nullInt(s.minLeaseMonths)
+	if s.availableFrom.Valid {
+		p.AvailableFrom = s.availableFrom.Time.Format(dateLayout)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/sirupsen/logrus"
+)
+
+// PropertyMediaHandler lists (GET /property/{id}/media) and removes
+// (DELETE /property/{id}/media/{media_id}) media finished through /uploads.
+func PropertyMediaHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewPropertyMedia(w, r)
+	case "DELETE":
+		deletePropertyMedia(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewPropertyMedia(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	rows, err := db.Query(`SELECT media_id, kind, blob_key, content_type, size, filename, created_at
+		FROM property_media WHERE property_id = $1 ORDER BY kind, created_at, media_id`, propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	media := []models.PropertyMedia{}
+	for rows.Next() {
+		m := models.PropertyMedia{PropertyID: propertyID}
+		var key string
+		var createdAt time.Time
+		if err := rows.Scan(&m.MediaID, &m.Kind, &key, &m.ContentType, &m.Size, &m.Filename, &createdAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		m.URL = blobs.URL(key)
+		m.CreatedAt = createdAt.Format(time.RFC3339)
+		media = append(media, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(media)
+}
+
+func deletePropertyMedia(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	propertyID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	mediaID, err := strconv.Atoi(vars["media_id"])
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	var key string
+	err = db.QueryRow("DELETE FROM property_media WHERE media_id = $1 AND property_id = $2 RETURNING blob_key",
+		mediaID, propertyID).Scan(&key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No media found with the given ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := blobs.Delete(r.Context(), key); err != nil {
+		config.Logger.Warn("Failed to delete blob", logrus.Fields{"key": key, "error": err})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
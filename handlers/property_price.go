@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPriceDropDays = 30
+	maxPriceDropDays     = 365
+)
+
+// askingPriceExpr is the price the history tracks for a row of properties p:
+// the sale price for sales and the monthly rent otherwise.
+const askingPriceExpr = "CASE WHEN p.listing_kind = 'sale' THEN p.prize ELSE p.monthly_rent END"
+
+func askingPrice(p *models.Property) float64 {
+	if p.ListingKind == models.ListingSale || p.MonthlyRent == nil {
+		return p.Prize
+	}
+	return *p.MonthlyRent
+}
+
+// recordPrice appends p's asking price to its history unless neither the
+// price nor the listing kind changed. prevKind is empty for new listings.
+func recordPrice(tx *sql.Tx, propertyID, userID int, prevKind string, prevPrice float64, p *models.Property) error {
+	price := askingPrice(p)
+	var old *float64
+	if prevKind == p.ListingKind {
+		// Prices are stored with two decimals.
+		if math.Round(prevPrice*100) == math.Round(price*100) {
+			return nil
+		}
+		old = &prevPrice
+	}
+	_, err := tx.Exec(`INSERT INTO property_price_history (property_id, listing_kind, old_price, new_price, changed_by)
+		VALUES ($1, $2, $3, $4, $5)`, propertyID, p.ListingKind, old, price, userID)
+	return err
+}
+
+// scanPriceChange fills in c from the old_price, new_price and changed_at
+// columns.
+func scanPriceChange(c *models.PriceChange, oldPrice sql.NullFloat64, changedAt time.Time) {
+	c.OldPrice = nullFloat(oldPrice)
+	c.ChangedAt = changedAt.Format(time.RFC3339)
+	if c.OldPrice != nil && *c.OldPrice != 0 {
+		pct := math.Round((c.NewPrice-*c.OldPrice) / *c.OldPrice * 10000) / 100
+		c.ChangePct = &pct
+	}
+}
+
+// PropertyPriceHistoryHandler lists every asking price a listing has had,
+// oldest first (GET /property/{id}/price-history).
+func PropertyPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	propertyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !authorizePropertyView(w, principal, propertyID) {
+		return
+	}
+
+	rows, err := db.Query(`SELECT listing_kind, old_price, new_price, changed_at
+		FROM property_price_history WHERE property_id = $1 ORDER BY changed_at, history_id`, propertyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := []models.PriceChange{}
+	for rows.Next() {
+		var c models.PriceChange
+		var oldPrice sql.NullFloat64
+		var changedAt time.Time
+		if err := rows.Scan(&c.ListingKind, &oldPrice, &c.NewPrice, &changedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		scanPriceChange(&c, oldPrice, changedAt)
+		history = append(history, c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+type priceDropItem struct {
+	Property models.Property    `json:"property"`
+	Change   models.PriceChange `json:"price_change"`
+}
+
+// PriceDropsHandler is the feed of published listings whose latest price
+// change within the last days (default 30) was a reduction, most recent first
+// (GET /property/price-drops?days=&min_drop_pct=&listing_kind=).
+func PriceDropsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := currentPrincipal(w, r); !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	pg, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pg.Keyset {
+		http.Error(w, "cursor pagination is not supported for price drops", http.StatusBadRequest)
+		return
+	}
+	days := defaultPriceDropDays
+	if raw := q.Get("days"); raw != "" {
+		if days, err = strconv.Atoi(raw); err != nil || days < 1 || days > maxPriceDropDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxPriceDropDays), http.StatusBadRequest)
+			return
+		}
+	}
+	minDropPct, err := parseOptionalFloat(q, "min_drop_pct")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kinds, err := parseEnumList(q, "listing_kind", models.ListingKinds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{"days": days, "min_drop_pct": minDropPct, "listing_kind": kinds, "page": pg})
+	cacheKey := propertyCacheKey("price-drops:" + string(b))
+	if cached, err := config.RedisClient.Get(cacheKey).Result(); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(cached))
+		return
+	}
+
+	// Only the latest change per listing counts, so a price that was cut
+	// and then raised again does not show up.
+	var qb queryBuilder
+	cte := `WITH latest AS (
+			SELECT DISTINCT ON (h.property_id) h.property_id, h.listing_kind, h.old_price, h.new_price, h.changed_at
+			FROM property_price_history h
+			WHERE h.changed_at >= CURRENT_TIMESTAMP - make_interval(days => ` + qb.arg(days) + `)
+			ORDER BY h.property_id, h.changed_at DESC, h.history_id DESC
+		)`
+	from := ` FROM latest l JOIN properties p ON p.property_id = l.property_id`
+	qb.cond("l.new_price < l.old_price")
+	qb.cond("p.status = '" + models.StatusPublished + "'")
+	if len(kinds) > 0 {
+		qb.cond("l.listing_kind = ANY(" + qb.arg(pq.Array(kinds)) + ")")
+	}
+	if minDropPct != nil {
+		qb.cond("(l.old_price - l.new_price) * 100 >= " + qb.arg(*minDropPct) + " * l.old_price")
+	}
+	where := qb.whereClause()
+
+	var total int64
+	if err := db.QueryRow(cte+` SELECT COUNT(*)`+from+where, qb.args...).Scan(&total); err != nil {
+		config.Logger.Error("Failed to count price drops", logrus.Fields{"error": err})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(cte+` SELECT
+		p.property_id, p.type, p.p_address, p.prize, `+propertyListingColumns+`, p.img_key, p.user_id, p.created_at, p.status,
+		l.listing_kind, l.old_price, l.new_price, l.changed_at`+from+where+
+		` ORDER BY l.changed_at DESC, p.property_id DESC`+pg.limit(&qb), qb.args...)
+	if err != nil {
+		config.Logger.Error("Failed to fetch price drops", logrus.Fields{"error": err})
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []priceDropItem{}
+	for rows.Next() {
+		var item priceDropItem
+		var terms listingScan
+		var imgKey sql.NullString
+		var createdAt, changedAt time.Time
+		var oldPrice sql.NullFloat64
+
+		dest := []interface{}{&item.Property.PropertyID, &item.Property.Type, &item.Property.PAddress, &item.Property.Prize}
+		dest = append(dest, terms.dest(&item.Property)...)
+		dest = append(dest, &imgKey, &item.Property.UserID, &createdAt, &item.Property.Status,
+			&item.Change.ListingKind, &oldPrice, &item.Change.NewPrice, &changedAt)
+		if err := rows.Scan(dest...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		terms.apply(&item.Property)
+		item.Property.ImgURL = blobURL(imgKey)
+		item.Property.ThumbURL = renditionURL(imgKey, imaging.Thumb)
+		item.Property.CreatedAt = createdAt.Format(time.RFC3339)
+		scanPriceChange(&item.Change, oldPrice, changedAt)
+		items = append(items, item)
+	}
+
+	jsonData, err := json.Marshal(paginatedResponse(pg, items, total, "", ""))
+	if err != nil {
+		http.Error(w, "Failed to encode price drops", http.StatusInternalServerError)
+		return
+	}
+	config.RedisClient.Set(cacheKey, string(jsonData), 10*time.Minute)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonData)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+func servePriceHistory(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/price-history", PropertyPriceHistoryHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPriceHistoryHiddenForDrafts(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(5, "draft"))
+
+	rec := servePriceHistory(asUser(httptest.NewRequest(http.MethodGet, "/property/1/price-history", nil), 9, "buyer"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestPriceHistoryReportsChange(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id, status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "status"}).AddRow(5, "published"))
+	mock.ExpectQuery("FROM property_price_history WHERE property_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"listing_kind", "old_price", "new_price", "changed_at"}).
+			AddRow("sale", nil, 8000000.0, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).
+			AddRow("sale", 8000000.0, 7600000.0, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)))
+
+	rec := servePriceHistory(asUser(httptest.NewRequest(http.MethodGet, "/property/1/price-history", nil), 9, "buyer"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var history []models.PriceChange
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].ChangePct != nil || history[1].ChangePct == nil || *history[1].ChangePct != -5 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+}
+
+func TestRecordPriceSkipsUnchangedPrice(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	rent := 25000.0
+	p := models.Property{ListingKind: models.ListingRent, MonthlyRent: &rent}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO property_price_history").
+		WithArgs(1, "rent", 27000.0, 25000.0, 4).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO property_price_history").
+		WithArgs(1, "rent", nil, 25000.0, 4).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recordPrice(tx, 1, 4, "rent", 25000.004, &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordPrice(tx, 1, 4, "rent", 27000, &p); err != nil {
+		t.Fatal(err)
+	}
+	// Switching from sale to rent starts a new series.
+	if err := recordPrice(tx, 1, 4, "sale", 9000000, &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+// salePrice is the asking price of a listing, NULL for rentals and leases
+// whose prize is always 0.
+const salePrice = "CASE WHEN p.listing_kind = '" + models.ListingSale + "' THEN p.prize END"
+
+// propertySorts maps the public sort names to ORDER BY clauses. The property
+// id is always the tie breaker so pages are stable.
+var propertySorts = map[string]string{
+	"newest":     "p.created_at DESC, p.property_id DESC",
+	"oldest":     "p.created_at ASC, p.property_id ASC",
+	"price_asc":  salePrice + " ASC NULLS LAST, p.property_id ASC",
+	"price_desc": salePrice + " DESC NULLS LAST, p.property_id DESC",
+	"rent_asc":   "p.monthly_rent ASC NULLS LAST, p.property_id ASC",
+	"rent_desc":  "p.monthly_rent DESC NULLS LAST, p.property_id DESC",
+	"relevance":  "rank DESC, p.property_id DESC",
+	"distance":   "distance_km ASC, p.property_id ASC",
+}
+
+const (
+	defaultRadiusKm = 5.0
+	maxRadiusKm     = 100.0
+)
+
+// textSearchConfig must match the configuration of the generated
+// search_vector column, otherwise stemmed terms will not line up.
+const textSearchConfig = "english"
+
+var searchTerm = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// propertyFilter is the parsed form of the GET /property query string.
+type propertyFilter struct {
+	Query    string             `json:"q,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	MinPrice *float64           `json:"min_price,omitempty"`
+	MaxPrice *float64           `json:"max_price,omitempty"`
+	Address  string             `json:"address,omitempty"`
+	OwnerID  int                `json:"owner,omitempty"`
+	Near     *utils.LatLng      `json:"near,omitempty"`
+	RadiusKm float64            `json:"radius_km,omitempty"`
+	BBox     *utils.BoundingBox `json:"bbox,omitempty"`
+	Statuses []string           `json:"status,omitempty"`
+	propertyAttributeFilter
+	propertyListingFilter
+	// Viewer limits unpublished listings to those owned by this user.
+	Viewer int    `json:"viewer,omitempty"`
+	Sort   string `json:"sort"`
+	pagination
+}
+
+// searchExprs are SQL expressions the filter produced that the select list
+// needs as well, to rank and measure each row.
+type searchExprs struct {
+	tsq      string
+	distance string
+}
+
+func parsePropertyFilter(q url.Values, principal middleware.Principal) (propertyFilter, error) {
+	f := propertyFilter{
+		Query:   buildTSQuery(q.Get("q")),
+		Type:    strings.TrimSpace(q.Get("type")),
+		Address: strings.TrimSpace(q.Get("address")),
+		Sort:    "newest",
+	}
+
+	var err error
+	if f.pagination, err = parsePagination(q); err != nil {
+		return f, err
+	}
+
+	if f.MinPrice, err = parseOptionalFloat(q, "min_price"); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = parseOptionalFloat(q, "max_price"); err != nil {
+		return f, err
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, fmt.Errorf("min_price cannot be greater than max_price")
+	}
+
+	switch owner := q.Get("owner"); owner {
+	case "":
+	case "me":
+		f.OwnerID = principal.UserID
+	default:
+		if f.OwnerID, err = strconv.Atoi(owner); err != nil || f.OwnerID < 1 {
+			return f, fmt.Errorf("invalid owner")
+		}
+	}
+
+	if near := q.Get("near"); near != "" {
+		p, err := utils.ParseLatLng(near)
+		if err != nil {
+			return f, fmt.Errorf("invalid near, expected lat,lng")
+		}
+		f.Near = &p
+		f.RadiusKm = defaultRadiusKm
+		if radius := q.Get("radius_km"); radius != "" {
+			if f.RadiusKm, err = strconv.ParseFloat(radius, 64); err != nil || f.RadiusKm <= 0 || f.RadiusKm > maxRadiusKm {
+				return f, fmt.Errorf("invalid radius_km, expected a value between 0 and %g", maxRadiusKm)
+			}
+		}
+	} else if q.Get("radius_km") != "" {
+		return f, fmt.Errorf("radius_km requires near")
+	}
+
+	// Buyers only ever see published listings; drafts and sold homes are
+	// visible to their owner, or to admins.
+	switch status := q.Get("status"); status {
+	case "":
+		f.Statuses = []string{models.StatusPublished}
+	case "all":
+	default:
+		for _, s := range strings.Split(status, ",") {
+			if !models.IsValidStatus(s) {
+				return f, fmt.Errorf("invalid status, expected draft, published, under_offer, sold, archived or all")
+			}
+			f.Statuses = append(f.Statuses, s)
+		}
+	}
+	if !isAdmin(principal) && (len(f.Statuses) != 1 || f.Statuses[0] != models.StatusPublished) {
+		f.Viewer = principal.UserID
+	}
+
+	if f.propertyAttributeFilter, err = parseAttributeFilter(q); err != nil {
+		return f, err
+	}
+	if f.propertyListingFilter, err = parseListingFilter(q); err != nil {
+		return f, err
+	}
+
+	if bbox := q.Get("bbox"); bbox != "" {
+		box, err := utils.ParseBBox(bbox)
+		if err != nil {
+			return f, err
+		}
+		f.BBox = &box
+	}
+
+	if sort := q.Get("sort"); sort != "" {
+		if _, ok := propertySorts[sort]; !ok {
+			return f, fmt.Errorf("invalid sort, expected one of newest, oldest, price_asc, price_desc, rent_asc, rent_desc, relevance, distance")
+		}
+		f.Sort = sort
+	} else if f.Query != "" && !f.Keyset {
+		f.Sort = "relevance"
+	} else if f.Near != nil && !f.Keyset {
+		f.Sort = "distance"
+	}
+	if f.Sort == "relevance" && f.Query == "" {
+		return f, fmt.Errorf("sort=relevance requires q")
+	}
+	if f.Sort == "distance" && f.Near == nil {
+		return f, fmt.Errorf("sort=distance requires near")
+	}
+	if f.Keyset && f.Sort != "newest" {
+		return f, fmt.Errorf("cursor pagination only supports sort=newest")
+	}
+
+	return f, nil
+}
+
+func parseOptionalFloat(q url.Values, key string) (*float64, error) {
+	raw := q.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("invalid %s", key)
+	}
+	return &v, nil
+}
+
+// buildTSQuery turns free text into a prefix matching tsquery, so "2BHK near
+// metro Ban" becomes "2bhk:* & near:* & metro:* & ban:*". Everything but
+// letters and digits is dropped, which keeps tsquery syntax out of user input.
+func buildTSQuery(text string) string {
+	terms := searchTerm.FindAllString(strings.ToLower(text), -1)
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// where builds the WHERE clause for the filter, appending its arguments to qb.
+func (f propertyFilter) where(qb *queryBuilder) (string, searchExprs) {
+	var exprs searchExprs
+	if f.Query != "" {
+		exprs.tsq = "to_tsquery('" + textSearchConfig + "', " + qb.arg(f.Query) + ")"
+		qb.cond("p.search_vector @@ " + exprs.tsq)
+	}
+	if f.Near != nil {
+		// The bounding box lets Postgres use the coordinate index before the
+		// exact haversine check trims the corners.
+		bboxCond(qb, utils.BoundsAround(*f.Near, f.RadiusKm))
+		exprs.distance = distanceExpr(qb.arg(f.Near.Lat), qb.arg(f.Near.Lng))
+		qb.cond(exprs.distance + " <= " + qb.arg(f.RadiusKm))
+	}
+	if f.BBox != nil {
+		bboxCond(qb, *f.BBox)
+	}
+	if f.Type != "" {
+		qb.cond("LOWER(p.type) = LOWER(" + qb.arg(f.Type) + ")")
+	}
+	if f.MinPrice != nil || f.MaxPrice != nil {
+		// Price bounds only make sense for listings with a sale price.
+		qb.cond("p.listing_kind = '" + models.ListingSale + "'")
+	}
+	if f.MinPrice != nil {
+		qb.cond("p.prize >= " + qb.arg(*f.MinPrice))
+	}
+	if f.MaxPrice != nil {
+		qb.cond("p.prize <= " + qb.arg(*f.MaxPrice))
+	}
+	if f.Address != "" {
+		qb.cond("p.p_address ILIKE " + qb.arg("%"+escapeLike(f.Address)+"%"))
+	}
+	if f.OwnerID != 0 {
+		qb.cond("p.user_id = " + qb.arg(f.OwnerID))
+	}
+	f.propertyAttributeFilter.where(qb)
+	f.propertyListingFilter.where(qb)
+	switch len(f.Statuses) {
+	case 0:
+	case 1:
+		qb.cond("p.status = " + qb.arg(f.Statuses[0]))
+	default:
+		qb.cond("p.status = ANY(" + qb.arg(pq.Array(f.Statuses)) + ")")
+	}
+	if f.Viewer != 0 {
+		qb.cond("(p.status = '" + models.StatusPublished + "' OR p.user_id = " + qb.arg(f.Viewer) + ")")
+	}
+	return qb.whereClause(), exprs
+}
+
+func bboxCond(qb *queryBuilder, box utils.BoundingBox) {
+	qb.cond("p.latitude BETWEEN " + qb.arg(box.South) + " AND " + qb.arg(box.North))
+	if box.West <= box.East {
+		qb.cond("p.longitude BETWEEN " + qb.arg(box.West) + " AND " + qb.arg(box.East))
+	} else {
+		qb.cond("(p.longitude >= " + qb.arg(box.West) + " OR p.longitude <= " + qb.arg(box.East) + ")")
+	}
+}
+
+// distanceExpr is the haversine distance in km from (lat, lng) to the row.
+func distanceExpr(lat, lng string) string {
+	return "(12742 * asin(sqrt(" +
+		"power(sin(radians(p.latitude - " + lat + ") / 2), 2) + " +
+		"cos(radians(" + lat + ")) * cos(radians(p.latitude)) * " +
+		"power(sin(radians(p.longitude - " + lng + ") / 2), 2))))"
+}
+
+// searchColumns selects the rank, highlighted snippet and distance of each
+// row. Without a text query or point they are constant so the scan targets
+// stay the same.
+func searchColumns(exprs searchExprs) string {
+	cols := "0::real AS rank, '' AS highlight"
+	if exprs.tsq != "" {
+		cols = "ts_rank(p.search_vector, " + exprs.tsq + ") AS rank, " +
+			"ts_headline('" + textSearchConfig + "', concat_ws(' ', p.type, p.p_address, p.description), " + exprs.tsq + ", " +
+			"'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2') AS highlight"
+	}
+	if exprs.distance != "" {
+		return cols + ", " + exprs.distance + " AS distance_km"
+	}
+	return cols + ", NULL::float8 AS distance_km"
+}
+
+func (f propertyFilter) orderBy() string {
+	if f.Keyset {
+		return f.keysetOrder("p.created_at", "p.property_id")
+	}
+	return propertySorts[f.Sort]
+}
+
+// cacheKey identifies the result page in Redis. It is built from the parsed
+// filter so equivalent query strings share an entry.
+func (f propertyFilter) cacheKey() string {
+	b, _ := json.Marshal(f)
+	return string(b)
+}
+
+// queryBuilder collects WHERE conditions and numbers their placeholders.
+type queryBuilder struct {
+	conds []string
+	args  []interface{}
+}
+
+func (qb *queryBuilder) arg(v interface{}) string {
+	qb.args = append(qb.args, v)
+	return "$" + strconv.Itoa(len(qb.args))
+}
+
+func (qb *queryBuilder) cond(c string) {
+	qb.conds = append(qb.conds, c)
+}
+
+func (qb *queryBuilder) whereClause() string {
+	if len(qb.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.conds, " AND ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
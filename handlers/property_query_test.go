@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+func TestParsePropertyFilter(t *testing.T) {
+	q, _ := url.ParseQuery("type=Flat&min_price=100&max_price=500&address=baner&owner=me&sort=price_asc&page=3&page_size=500")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 12})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if f.Type != "Flat" || *f.MinPrice != 100 || *f.MaxPrice != 500 || f.OwnerID != 12 {
+		t.Fatalf("unexpected filter: %+v", f)
+	}
+	if f.Page != 3 || f.PageSize != maxPageSize || f.offset() != 2*maxPageSize {
+		t.Fatalf("unexpected paging: %+v", f)
+	}
+
+	var qb queryBuilder
+	where, _ := f.where(&qb)
+	want := " WHERE LOWER(p.type) = LOWER($1) AND p.listing_kind = 'sale' AND p.prize >= $2 AND p.prize <= $3 AND p.p_address ILIKE $4 AND p.user_id = $5 AND p.status = $6"
+	if where != want {
+		t.Fatalf("unexpected where clause:\n got %s\nwant %s", where, want)
+	}
+	if qb.args[3] != "%baner%" {
+		t.Fatalf("unexpected address pattern %v", qb.args[3])
+	}
+}
+
+func TestParsePropertyFilterRejectsBadInput(t *testing.T) {
+	for _, raw := range []string{
+		"min_price=abc",
+		"min_price=10&max_price=5",
+		"sort=random",
+		"page=0",
+		"page_size=-1",
+		"owner=someone",
+	} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestParseAttributeFilter(t *testing.T) {
+	q, _ := url.ParseQuery("bedrooms=3,2&min_area=100&area_unit=sqm&furnishing=furnished&amenities=Lift,gym,lift")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(*f.MinAreaSqft-1076.39) > 0.001 || len(f.Amenities) != 2 || f.Amenities[0] != "gym" {
+		t.Fatalf("unexpected filter: %+v", f.propertyAttributeFilter)
+	}
+
+	var qb queryBuilder
+	where, _ := f.where(&qb)
+	for _, want := range []string{"p.bedrooms = ANY($1)", "p.area_sqft >= $2", "p.furnishing = ANY($3)", "HAVING COUNT(*) = $5)"} {
+		if !strings.Contains(where, want) {
+			t.Fatalf("expected %q in where clause %s", want, where)
+		}
+	}
+
+	for _, raw := range []string{"bedrooms=two", "min_bathrooms=-1", "area_unit=acre", "facing=up", "furnishing=partly"} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestParseListingFilter(t *testing.T) {
+	q, _ := url.ParseQuery("listing_kind=rent,lease&max_rent=30000&available_by=2026-01-01&lease_months=11&sort=rent_asc")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var qb queryBuilder
+	where, _ := f.where(&qb)
+	want := " WHERE p.listing_kind = ANY($1) AND p.monthly_rent <= $2 AND (p.available_from IS NULL OR p.available_from <= $3)" +
+		" AND (p.min_lease_months IS NULL OR p.min_lease_months <= $4) AND p.status = $5"
+	if where != want {
+		t.Fatalf("unexpected where clause:\n got %s\nwant %s", where, want)
+	}
+
+	for _, raw := range []string{"listing_kind=buy", "min_rent=10&max_rent=5", "available_by=tomorrow", "lease_months=0"} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestViewPropertiesPaginates(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM properties p WHERE p.listing_kind = 'sale' AND p.prize >= \$1 AND p.status = \$2`).
+		WithArgs(1000.0, "published").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`ORDER BY p.created_at DESC, p.property_id DESC LIMIT \$3 OFFSET \$4`).
+		WithArgs(1000.0, "published", 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"property_id", "type", "p_address", "description", "prize",
+			"listing_kind", "monthly_rent", "security_deposit", "maintenance", "min_lease_months", "available_from", "map_link", "latitude", "longitude",
+			"img", "user_id", "created_at", "status", "published_at", "under_offer_at", "sold_at", "archived_at",
+			"bedrooms", "bathrooms", "carpet_area", "built_up_area", "area_unit", "floor", "total_floors",
+			"facing", "furnishing", "parking", "year_built", "amenities", "favorite_count",
+			"name", "email", "rank", "highlight", "distance_km"}).
+			AddRow(1, "Flat", "Baner", nil, 1500.0, "sale", nil, nil, nil, nil, nil, "", nil, nil, "properties/1/a.jpg", 4, time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+				"published", time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC), nil, nil, nil,
+				2, 2, 950.0, nil, "sqft", 3, 12, "east", "", 1, nil, "{gym,lift}", 3,
+				"Asha", "asha@example.com", 0.0, "", nil))
+	mock.ExpectQuery(`FROM property_images WHERE property_id = ANY\(\$1\)`).
+		WithArgs("{1}").
+		WillReturnRows(sqlmock.NewRows([]string{"image_id", "property_id", "blob_key", "position", "is_cover"}).
+			AddRow(7, 1, "properties/1/a.jpg", 0, true).
+			AddRow(8, 1, "properties/1/b.jpg", 1, false))
+
+	req := asUser(httptest.NewRequest(http.MethodGet, "/property?min_price=1000&page=2&page_size=2", nil), 4, "buyer")
+	rec := httptest.NewRecorder()
+	viewProperties(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body struct {
+		Items      []propertyListItem `json:"items"`
+		TotalItems int64              `json:"total_items"`
+		TotalPages int                `json:"total_pages"`
+	}
+	if err := json.NewDecoder(strings.NewReader(rec.Body.String())).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.TotalItems != 3 || body.TotalPages != 2 || len(body.Items) != 1 {
+		t.Fatalf("unexpected page: %+v", body)
+	}
+	if images := body.Items[0].Property.Images; len(images) != 2 || !images[0].IsCover || images[1].ThumbURL != "/static/uploads/properties/1/b_thumb.jpg" || images[1].URL != "" {
+		t.Fatalf("unexpected gallery: %+v", images)
+	}
+	if p := body.Items[0].Property; p.ImgURL != "/static/uploads/properties/1/a.jpg" || p.ThumbURL != "/static/uploads/properties/1/a_thumb.jpg" {
+		t.Fatalf("unexpected cover: %q, %q", p.ImgURL, p.ThumbURL)
+	}
+	if p := body.Items[0].Property; p.Bedrooms == nil || *p.Bedrooms != 2 || p.BuiltUpArea != nil || len(p.Amenities) != 2 || p.Facing != "east" {
+		t.Fatalf("unexpected attributes: %+v", p)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeysetPage(t *testing.T) {
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	key := func(id int) utils.Cursor {
+		return utils.Cursor{CreatedAt: base.Add(time.Duration(id) * time.Minute), ID: id}
+	}
+
+	// First page: newest first, one look-ahead row fetched.
+	first := pagination{PageSize: 2, Keyset: true}
+	items, next, prev := keysetPage(first, []int{9, 8, 7}, key)
+	if len(items) != 2 || items[1] != 8 || next == "" || prev != "" {
+		t.Fatalf("unexpected first page: %v next=%q prev=%q", items, next, prev)
+	}
+
+	c, err := utils.DecodeCursor(next)
+	if err != nil || c.ID != 8 || c.Backward {
+		t.Fatalf("unexpected next cursor %+v, %v", c, err)
+	}
+
+	// Going back from item 7: rows come oldest first and must be reversed.
+	back := pagination{PageSize: 2, Keyset: true, Cursor: &utils.Cursor{CreatedAt: key(7).CreatedAt, ID: 7, Backward: true}}
+	items, next, prev = keysetPage(back, []int{8, 9}, key)
+	if len(items) != 2 || items[0] != 9 || next == "" || prev != "" {
+		t.Fatalf("unexpected backward page: %v next=%q prev=%q", items, next, prev)
+	}
+}
+
+func TestParsePaginationRejectsBadCursor(t *testing.T) {
+	q, _ := url.ParseQuery("cursor=not-a-cursor")
+	if _, err := parsePagination(q); err == nil {
+		t.Fatal("expected an invalid cursor error")
+	}
+
+	q, _ = url.ParseQuery("cursor=&sort=price_asc")
+	if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+		t.Fatal("expected keyset paging to reject non-default sorts")
+	}
+}
+
+func TestBuildTSQuery(t *testing.T) {
+	cases := map[string]string{
+		"2BHK near metro Baner": "2bhk:* & near:* & metro:* & baner:*",
+		"  Koregaon-Park!! ":    "koregaon:* & park:*",
+		"') | !(":               "",
+	}
+	for in, want := range cases {
+		if got := buildTSQuery(in); got != want {
+			t.Errorf("buildTSQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestTextQueryDefaultsToRelevance(t *testing.T) {
+	q, _ := url.ParseQuery("q=baner+metro")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Sort != "relevance" {
+		t.Fatalf("expected relevance sort, got %q", f.Sort)
+	}
+
+	var qb queryBuilder
+	where, exprs := f.where(&qb)
+	if where != " WHERE p.search_vector @@ to_tsquery('english', $1) AND p.status = $2" || exprs.tsq == "" {
+		t.Fatalf("unexpected where clause %q", where)
+	}
+
+	q, _ = url.ParseQuery("sort=relevance")
+	if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+		t.Fatal("expected relevance without q to be rejected")
+	}
+}
+
+func TestNearFilterSortsByDistance(t *testing.T) {
+	q, _ := url.ParseQuery("near=18.52,73.85&radius_km=3")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f.Sort != "distance" || f.RadiusKm != 3 {
+		t.Fatalf("unexpected filter: %+v", f)
+	}
+
+	var qb queryBuilder
+	where, exprs := f.where(&qb)
+	if exprs.distance == "" || !strings.Contains(where, "p.latitude BETWEEN $1 AND $2") || !strings.Contains(where, "<= $7") {
+		t.Fatalf("unexpected where clause %q", where)
+	}
+
+	for _, raw := range []string{"near=18.52", "radius_km=3", "near=18.52,73.85&radius_km=500", "sort=distance"} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestStatusFilterLimitsUnpublishedToOwner(t *testing.T) {
+	q, _ := url.ParseQuery("status=draft,published")
+	f, err := parsePropertyFilter(q, middleware.Principal{UserID: 7, Role: "owner"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var qb queryBuilder
+	where, _ := f.where(&qb)
+	if where != " WHERE p.status = ANY($1) AND (p.status = 'published' OR p.user_id = $2)" || qb.args[1] != 7 {
+		t.Fatalf("unexpected where clause %q %v", where, qb.args)
+	}
+
+	q, _ = url.ParseQuery("status=all")
+	f, _ = parsePropertyFilter(q, middleware.Principal{UserID: 1, Role: "admin"})
+	qb = queryBuilder{}
+	if where, _ := f.where(&qb); where != "" {
+		t.Fatalf("expected admins to see every status, got %q", where)
+	}
+
+	q, _ = url.ParseQuery("status=deleted")
+	if _, err := parsePropertyFilter(q, middleware.Principal{UserID: 1}); err == nil {
+		t.Fatal("expected unknown status to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+type statusAction struct {
+	to string
+	// from narrows the statuses the action applies to. When empty, any
+	// status the state machine allows into to will do.
+	from []string
+}
+
+// statusActions maps the transition endpoints to the status they move a
+// listing to. Unpublishing and restoring both lead back to draft, so each is
+// tied to its own source status.
+var statusActions = map[string]statusAction{
+	"publish":          {to: models.StatusPublished},
+	"unpublish":        {models.StatusDraft, []string{models.StatusPublished}},
+	"mark-under-offer": {to: models.StatusUnderOffer},
+	"mark-sold":        {to: models.StatusSold},
+	"archive":          {to: models.StatusArchived},
+	"restore":          {models.StatusDraft, []string{models.StatusArchived}},
+}
+
+// statusTimestamps is the column stamped when a listing enters a status.
+var statusTimestamps = map[string]string{
+	models.StatusPublished:  "published_at",
+	models.StatusUnderOffer: "under_offer_at",
+	models.StatusSold:       "sold_at",
+	models.StatusArchived:   "archived_at",
+}
+
+// PropertyStatusHandler moves a listing through its lifecycle
+// (POST /property/{id}/{action}, e.g. /property/3/publish).
+func PropertyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	propertyID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid property ID", http.StatusBadRequest)
+		return
+	}
+	action, ok := statusActions[vars["action"]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	to, from := action.to, action.from
+	if len(from) == 0 {
+		from = models.StatusesLeadingTo(to)
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	set := "status = $1"
+	if col, ok := statusTimestamps[to]; ok {
+		set += ", " + col + " = CURRENT_TIMESTAMP"
+	}
+
+	// The WHERE clause enforces the state machine, so a concurrent change
+	// cannot slip an invalid transition through.
+	var changedAt time.Time
+	err = db.QueryRow(`UPDATE properties SET `+set+`
+		WHERE property_id = $2 AND status = ANY($3)
+		RETURNING CURRENT_TIMESTAMP`, to, propertyID, pq.Array(from)).Scan(&changedAt)
+	if err == sql.ErrNoRows {
+		var current string
+		if err := db.QueryRow("SELECT status FROM properties WHERE property_id = $1", propertyID).Scan(&current); err != nil {
+			http.Error(w, "No property found with the given ID", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Cannot move a "+current+" property to "+to, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invalidatePropertyCache()
+	if to == models.StatusPublished {
+		queueAlertMatch(propertyID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     to,
+		"changed_at": changedAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func serveStatus(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}/{action}", PropertyStatusHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMarkSoldStampsTransition(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectQuery(`UPDATE properties SET status = \$1, sold_at = CURRENT_TIMESTAMP`).
+		WithArgs("sold", 1, `{"published","under_offer"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"now"}).AddRow(time.Now()))
+
+	rec := serveStatus(asUser(httptest.NewRequest(http.MethodPost, "/property/1/mark-sold", nil), 4, "owner"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestInvalidTransitionConflicts(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectQuery(`UPDATE properties SET status = \$1, published_at = CURRENT_TIMESTAMP`).
+		WithArgs("published", 1, `{"draft","under_offer"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"now"}))
+	mock.ExpectQuery("SELECT status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("sold"))
+
+	rec := serveStatus(asUser(httptest.NewRequest(http.MethodPost, "/property/1/publish", nil), 4, "owner"))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRestoreOnlyAppliesToArchived(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectQuery(`UPDATE properties SET status = \$1 WHERE`).
+		WithArgs("draft", 1, `{"archived"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"now"}))
+	mock.ExpectQuery("SELECT status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("published"))
+
+	rec := serveStatus(asUser(httptest.NewRequest(http.MethodPost, "/property/1/restore", nil), 4, "owner"))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpublishOnlyAppliesToPublished(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectQuery(`UPDATE properties SET status = \$1 WHERE`).
+		WithArgs("draft", 1, `{"published"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"now"}))
+	mock.ExpectQuery("SELECT status FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("archived"))
+
+	rec := serveStatus(asUser(httptest.NewRequest(http.MethodPost, "/property/1/unpublish", nil), 4, "owner"))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+)
+
+func asUser(req *http.Request, userID int, role string) *http.Request {
+	ctx := middleware.WithPrincipal(req.Context(), middleware.Principal{UserID: userID, Role: role})
+	return req.WithContext(ctx)
+}
+
+func TestDeletePropertyForbiddenForNonOwner(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/property/1", nil), 9, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}", deleteProperty)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status 403, got %d", rec.Code)
+	}
+}
+
+func TestDeletePropertyAllowedForAdmin(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("SELECT user_id FROM properties").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+	mock.ExpectQuery("SELECT blob_key FROM property_images").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"blob_key"}))
+	mock.ExpectPrepare("DELETE FROM properties").
+		ExpectExec().
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/property/1", nil), 9, "admin")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/property/{id}", deleteProperty)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rec.Code)
+	}
+}
+
+func TestValidateListingTerms(t *testing.T) {
+	rent, months := 25000.0, 11
+	for _, tc := range []struct {
+		name string
+		p    models.Property
+		ok   bool
+	}{
+		{"sale", models.Property{Prize: 5000000}, true},
+		{"sale without price", models.Property{}, false},
+		{"sale with rent", models.Property{Prize: 5000000, MonthlyRent: &rent}, false},
+		{"rent", models.Property{ListingKind: "rent", MonthlyRent: &rent, AvailableFrom: "2026-02-01"}, true},
+		{"rent without rent", models.Property{ListingKind: "rent"}, false},
+		{"rent with price", models.Property{ListingKind: "rent", Prize: 10, MonthlyRent: &rent}, false},
+		{"rent with bad date", models.Property{ListingKind: "rent", MonthlyRent: &rent, AvailableFrom: "01/02/2026"}, false},
+		{"lease without term", models.Property{ListingKind: "lease", MonthlyRent: &rent}, false},
+		{"lease", models.Property{ListingKind: "lease", MonthlyRent: &rent, MinLeaseMonths: &months}, true},
+		{"unknown kind", models.Property{ListingKind: "swap"}, false},
+	} {
+		err := validateListingTerms(&tc.p)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected result %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/models"
+	"github.com/prem0x01/propertyAPI/notify"
+)
+
+const maxSavedSearches = 50
+
+// searchOnlyParams are dropped from saved queries: they page and order a
+// result list, but do not decide which listings match. Alerts are only
+// raised for published listings, so status goes as well.
+var searchOnlyParams = []string{"page", "page_size", "cursor", "sort", "status"}
+
+// normalizeSearchQuery validates a GET /property query string as userID would
+// run it and returns it in canonical form.
+func normalizeSearchQuery(raw string, userID int) (string, error) {
+	q, err := url.ParseQuery(strings.TrimPrefix(strings.TrimSpace(raw), "?"))
+	if err != nil {
+		return "", fmt.Errorf("invalid query")
+	}
+	for _, key := range searchOnlyParams {
+		q.Del(key)
+	}
+	if _, err := parsePropertyFilter(q, middleware.Principal{UserID: userID}); err != nil {
+		return "", err
+	}
+	return q.Encode(), nil
+}
+
+func validateSavedSearch(s *models.SavedSearch) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.Channel == "" {
+		s.Channel = notify.InApp
+	}
+	if !notify.IsValidChannel(s.Channel) {
+		return fmt.Errorf("invalid channel, expected email, sms or in_app")
+	}
+	if s.Frequency == "" {
+		s.Frequency = models.FrequencyInstant
+	}
+	if s.Frequency != models.FrequencyInstant && s.Frequency != models.FrequencyDaily {
+		return fmt.Errorf("invalid frequency, expected instant or daily")
+	}
+
+	var err error
+	s.Query, err = normalizeSearchQuery(s.Query, s.UserID)
+	return err
+}
+
+// userScope parses the {id} of a /user/{id}/... route and checks the caller
+// may act for that user, writing the error response when not.
+func userScope(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return 0, false
+	}
+	if !canManageUser(principal, userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return 0, false
+	}
+	return userID, true
+}
+
+// SavedSearchesHandler manages saved searches: GET and POST
+// /user/{id}/searches, PUT and DELETE /user/{id}/searches/{search_id}.
+func SavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewSavedSearches(w, r)
+	case "POST":
+		addSavedSearch(w, r)
+	case "PUT":
+		updateSavedSearch(w, r)
+	case "DELETE":
+		deleteSavedSearch(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewSavedSearches(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := db.Query(`SELECT search_id, name, query, channel, frequency, created_at
+		FROM saved_searches WHERE user_id = $1 ORDER BY created_at, search_id`, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	searches := []models.SavedSearch{}
+	for rows.Next() {
+		s := models.SavedSearch{UserID: userID}
+		var createdAt time.Time
+		if err := rows.Scan(&s.SearchID, &s.Name, &s.Query, &s.Channel, &s.Frequency, &createdAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.CreatedAt = createdAt.Format(time.RFC3339)
+		searches = append(searches, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(searches)
+}
+
+func addSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+
+	var s models.SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.UserID = userID
+	if err := validateSavedSearch(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var createdAt time.Time
+	err := db.QueryRow(`INSERT INTO saved_searches (user_id, name, query, channel, frequency)
+		SELECT $1, $2, $3, $4, $5
+		WHERE (SELECT COUNT(*) FROM saved_searches WHERE user_id = $1) < $6
+		RETURNING search_id, created_at`,
+		s.UserID, s.Name, s.Query, s.Channel, s.Frequency, maxSavedSearches).Scan(&s.SearchID, &createdAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, fmt.Sprintf("Users can keep at most %d saved searches", maxSavedSearches), http.StatusConflict)
+		return
+	}
+	if isUniqueViolation(err, "") {
+		http.Error(w, "A saved search with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.CreatedAt = createdAt.Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+func updateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+	searchID, err := strconv.Atoi(mux.Vars(r)["search_id"])
+	if err != nil {
+		http.Error(w, "Invalid search ID", http.StatusBadRequest)
+		return
+	}
+
+	var s models.SavedSearch
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.SearchID, s.UserID = searchID, userID
+	if err := validateSavedSearch(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var createdAt time.Time
+	err = db.QueryRow(`UPDATE saved_searches SET name = $1, query = $2, channel = $3, frequency = $4
+		WHERE search_id = $5 AND user_id = $6 RETURNING created_at`,
+		s.Name, s.Query, s.Channel, s.Frequency, s.SearchID, s.UserID).Scan(&createdAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No saved search found with the given ID", http.StatusNotFound)
+		return
+	}
+	if isUniqueViolation(err, "") {
+		http.Error(w, "A saved search with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.CreatedAt = createdAt.Format(time.RFC3339)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func deleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+	searchID, err := strconv.Atoi(mux.Vars(r)["search_id"])
+	if err != nil {
+		http.Error(w, "Invalid search ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.Exec("DELETE FROM saved_searches WHERE search_id = $1 AND user_id = $2", searchID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "No saved search found with the given ID", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AlertsHandler is the in-app inbox of saved search alerts: GET
+// /user/{id}/alerts lists them newest first (?unread=true for unread only),
+// PUT /user/{id}/alerts/{alert_id}/read marks one as read.
+func AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		viewAlerts(w, r)
+	case "PUT":
+		markAlertRead(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func viewAlerts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	pg, err := parsePagination(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if pg.Keyset {
+		http.Error(w, "cursor pagination is not supported for alerts", http.StatusBadRequest)
+		return
+	}
+
+	var qb queryBuilder
+	qb.cond("s.user_id = " + qb.arg(userID))
+	if q.Get("unread") == "true" {
+		qb.cond("a.read_at IS NULL")
+	}
+	from := ` FROM search_alerts a
+		JOIN saved_searches s ON s.search_id = a.search_id
+		JOIN properties p ON p.property_id = a.property_id` + qb.whereClause()
+
+	var total int64
+	if err := db.QueryRow(`SELECT COUNT(*)`+from, qb.args...).Scan(&total); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(`SELECT a.alert_id, a.search_id, s.name, a.created_at, a.sent_at, a.read_at,
+		p.property_id, p.type, p.p_address, p.prize, `+propertyListingColumns+`, p.img_key, p.status`+from+
+		` ORDER BY a.created_at DESC, a.alert_id DESC`+pg.limit(&qb), qb.args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.SearchAlert{}
+	for rows.Next() {
+		var a models.SearchAlert
+		var terms listingScan
+		var imgKey sql.NullString
+		var createdAt time.Time
+		var sentAt, readAt sql.NullTime
+
+		dest := []interface{}{&a.AlertID, &a.SearchID, &a.SearchName, &createdAt, &sentAt, &readAt,
+			&a.Property.PropertyID, &a.Property.Type, &a.Property.PAddress, &a.Property.Prize}
+		dest = append(dest, terms.dest(&a.Property)...)
+		dest = append(dest, &imgKey, &a.Property.Status)
+		if err := rows.Scan(dest...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		terms.apply(&a.Property)
+		a.Property.ImgURL = blobURL(imgKey)
+		a.Property.ThumbURL = renditionURL(imgKey, imaging.Thumb)
+		a.CreatedAt = createdAt.Format(time.RFC3339)
+		a.SentAt = nullTime(sentAt)
+		a.ReadAt = nullTime(readAt)
+		alerts = append(alerts, a)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginatedResponse(pg, alerts, total, "", ""))
+}
+
+func markAlertRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userScope(w, r)
+	if !ok {
+		return
+	}
+	alertID, err := strconv.Atoi(mux.Vars(r)["alert_id"])
+	if err != nil {
+		http.Error(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+
+	res, err := db.Exec(`UPDATE search_alerts a SET read_at = COALESCE(a.read_at, CURRENT_TIMESTAMP)
+		FROM saved_searches s
+		WHERE a.alert_id = $1 AND s.search_id = a.search_id AND s.user_id = $2`, alertID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "No alert found with the given ID", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
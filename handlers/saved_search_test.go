@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prem0x01/propertyAPI/notify"
+)
+
+type recordingSender struct {
+	sent []notify.Message
+}
+
+func (s *recordingSender) Send(ctx context.Context, m notify.Message) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	got, err := normalizeSearchQuery("?type=Flat&sort=price_asc&page=2&max_price=9000000&status=all", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "max_price=9000000&type=Flat" {
+		t.Fatalf("unexpected query %q", got)
+	}
+
+	for _, raw := range []string{"min_price=abc", "listing_kind=swap", "near=1"} {
+		if _, err := normalizeSearchQuery(raw, 4); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestMatchSavedSearchesSendsInstantAlert(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	email := &recordingSender{}
+	InitNotifier(notify.Dispatcher{notify.Email: email})
+
+	mock.ExpectQuery("FROM saved_searches s").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"search_id", "user_id", "role", "query", "frequency"}).
+			AddRow(3, 7, "buyer", "type=Flat", "instant").
+			AddRow(4, 8, "buyer", "type=Villa", "instant"))
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM properties p WHERE p.property_id = \$1 AND LOWER\(p.type\) = LOWER\(\$2\) AND p.status = \$3\)`).
+		WithArgs(1, "Flat", "published").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("INSERT INTO search_alerts").
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"alert_id"}).AddRow(11))
+	mock.ExpectQuery("SELECT EXISTS").
+		WithArgs(1, "Villa", "published").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("FROM search_alerts a").
+		WithArgs("{11}").
+		WillReturnRows(sqlmock.NewRows([]string{"alert_id", "search_id", "name", "channel", "frequency", "user_id", "email", "mobile",
+			"property_id", "type", "p_address", "prize", "listing_kind", "monthly_rent"}).
+			AddRow(11, 3, "Baner flats", "email", "instant", 7, "asha@example.com", "9800000000",
+				1, "Flat", "Baner", 0.0, "rent", 25000.0))
+	mock.ExpectExec("UPDATE search_alerts SET sent_at").
+		WithArgs("{11}").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := matchSavedSearches(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(email.sent) != 1 {
+		t.Fatalf("expected one email, got %d", len(email.sent))
+	}
+	m := email.sent[0]
+	if m.To != "asha@example.com" || !strings.Contains(m.Subject, "Baner flats") || !strings.Contains(m.Body, "25000 per month") {
+		t.Fatalf("unexpected message %+v", m)
+	}
+}
@@ -0,0 +1,480 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// Resumable uploads follow the tus 1.0 core protocol with the creation,
+// termination and expiration extensions (https://tus.io/protocols/resumable-upload).
+const (
+	tusVersion      = "1.0.0"
+	tusExtensions   = "creation,termination,expiration"
+	maxMediaUpload  = 4 << 30
+	uploadLifetime  = 24 * time.Hour
+	offsetMediaType = "application/offset+octet-stream"
+)
+
+// mediaTypes lists the sniffed content types accepted for each media kind
+// and the extension they are stored with.
+var mediaTypes = map[string]map[string]string{
+	"video": {
+		"video/mp4":  ".mp4",
+		"video/webm": ".webm",
+	},
+	"floor_plan": {
+		"application/pdf": ".pdf",
+		"image/png":       ".png",
+		"image/jpeg":      ".jpg",
+	},
+}
+
+var uploadDir string
+
+// InitUploads sets the directory chunks are staged in until an upload is
+// complete and streamed to the blob store.
+func InitUploads(dir string) error {
+	uploadDir = dir
+	return os.MkdirAll(dir, 0o755)
+}
+
+// uploadLocks keeps two PATCH requests for the same upload from writing to
+// the staging file at once.
+var uploadLocks = struct {
+	sync.Mutex
+	busy map[string]bool
+}{busy: map[string]bool{}}
+
+func lockUpload(id string) bool {
+	uploadLocks.Lock()
+	defer uploadLocks.Unlock()
+	if uploadLocks.busy[id] {
+		return false
+	}
+	uploadLocks.busy[id] = true
+	return true
+}
+
+func unlockUpload(id string) {
+	uploadLocks.Lock()
+	delete(uploadLocks.busy, id)
+	uploadLocks.Unlock()
+}
+
+type upload struct {
+	ID         string
+	UserID     int
+	PropertyID int
+	Kind       string
+	Filename   string
+	Size       int64
+	Received   int64
+	ExpiresAt  time.Time
+	Completed  bool
+}
+
+func (u upload) stagingPath() string {
+	return filepath.Join(uploadDir, u.ID)
+}
+
+// UploadsHandler creates uploads (POST /uploads) and advertises the protocol
+// (OPTIONS /uploads).
+func UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxMediaUpload, 10))
+		w.WriteHeader(http.StatusNoContent)
+	case "POST":
+		createUpload(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// UploadHandler reports (HEAD), continues (PATCH) and cancels (DELETE) an
+// upload at /uploads/{id}.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return
+	}
+
+	switch r.Method {
+	case "HEAD":
+		uploadStatusHandler(w, r)
+	case "PATCH":
+		patchUpload(w, r)
+	case "DELETE":
+		terminateUpload(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func createUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported Tus-Resumable version", http.StatusPreconditionFailed)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 1 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if size > maxMediaUpload {
+		http.Error(w, "Upload exceeds Tus-Max-Size", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	propertyID, err := strconv.Atoi(meta["property_id"])
+	if err != nil {
+		http.Error(w, "Upload-Metadata must include property_id", http.StatusBadRequest)
+		return
+	}
+	kind := meta["kind"]
+	if _, ok := mediaTypes[kind]; !ok {
+		http.Error(w, "Upload-Metadata kind must be video or floor_plan", http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeProperty(w, principal, propertyID) {
+		return
+	}
+
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filename := meta["filename"]
+	if filename != "" {
+		filename = path.Base(filename)
+	}
+	u := upload{ID: id, UserID: principal.UserID, PropertyID: propertyID, Kind: kind,
+		Filename: filename, Size: size, ExpiresAt: time.Now().Add(uploadLifetime).UTC()}
+
+	f, err := os.OpenFile(u.stagingPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		config.Logger.Error("Failed to create upload staging file", logrus.Fields{"error": err})
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	f.Close()
+
+	_, err = db.Exec(`INSERT INTO uploads (upload_id, user_id, property_id, kind, filename, size, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, u.ID, u.UserID, u.PropertyID, u.Kind, u.Filename, u.Size, u.ExpiresAt)
+	if err != nil {
+		os.Remove(u.stagingPath())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/uploads/"+u.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, a comma separated
+// list of "key base64(value)" pairs.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, fmt.Errorf("invalid Upload-Metadata")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %s", key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// loadUpload fetches the upload in the URL and checks the caller owns it,
+// writing the error response when it does not.
+func loadUpload(w http.ResponseWriter, r *http.Request, principal middleware.Principal) (upload, bool) {
+	u := upload{ID: mux.Vars(r)["id"]}
+	err := db.QueryRow(`SELECT user_id, property_id, kind, filename, size, received, expires_at, completed_at IS NOT NULL
+		FROM uploads WHERE upload_id = $1`, u.ID).
+		Scan(&u.UserID, &u.PropertyID, &u.Kind, &u.Filename, &u.Size, &u.Received, &u.ExpiresAt, &u.Completed)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No upload found with the given ID", http.StatusNotFound)
+		return u, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return u, false
+	}
+	if u.UserID != principal.UserID && !isAdmin(principal) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return u, false
+	}
+	if !u.Completed && time.Now().After(u.ExpiresAt) {
+		http.Error(w, "Upload expired", http.StatusGone)
+		return u, false
+	}
+	return u, true
+}
+
+func uploadStatusHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	u, ok := loadUpload(w, r, principal)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Received, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	if !u.Completed {
+		w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// patchUpload appends one chunk. Whatever arrived before a dropped connection
+// is kept, so the client resumes from the offset HEAD reports.
+func patchUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != offsetMediaType {
+		http.Error(w, "Content-Type must be "+offsetMediaType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !lockUpload(id) {
+		http.Error(w, "Upload is being written by another request", http.StatusLocked)
+		return
+	}
+	defer unlockUpload(id)
+
+	u, ok := loadUpload(w, r, principal)
+	if !ok {
+		return
+	}
+	if offset != u.Received {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Received, 10))
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+
+	n, copyErr := writeChunk(u, r.Body)
+	if n > 0 {
+		if _, err := db.Exec("UPDATE uploads SET received = $1 WHERE upload_id = $2 AND received = $3",
+			u.Received+n, u.ID, u.Received); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		u.Received += n
+	}
+	if copyErr != nil {
+		config.Logger.Warn("Upload chunk interrupted", logrus.Fields{"upload_id": u.ID, "received": u.Received, "error": copyErr})
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Received, 10))
+		http.Error(w, copyErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if u.Received == u.Size && !u.Completed {
+		if status, err := completeUpload(r.Context(), u); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Received, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeChunk appends body to the staging file at the recorded offset. Bytes
+// past a previous partial write that never got recorded are overwritten.
+func writeChunk(u upload, body io.Reader) (int64, error) {
+	f, err := os.OpenFile(u.stagingPath(), os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(u.Received); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(u.Received, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	remaining := u.Size - u.Received
+	n, err := io.Copy(f, io.LimitReader(body, remaining))
+	if err == nil {
+		// Anything beyond Upload-Length is a client error.
+		var extra [1]byte
+		if m, _ := body.Read(extra[:]); m > 0 {
+			err = fmt.Errorf("chunk exceeds Upload-Length")
+		}
+	}
+	if syncErr := f.Sync(); err == nil {
+		err = syncErr
+	}
+	return n, err
+}
+
+// completeUpload checks what was uploaded, streams it from the staging file
+// to the blob store and attaches it to the property.
+func completeUpload(ctx context.Context, u upload) (int, error) {
+	f, err := os.Open(u.stagingPath())
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := mediaTypes[u.Kind][contentType]
+	if !ok {
+		discardUpload(u)
+		return http.StatusUnsupportedMediaType, fmt.Errorf("unsupported %s type %s", u.Kind, contentType)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	name, err := utils.RandomToken(16)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	key := fmt.Sprintf("properties/%d/media/%s%s", u.PropertyID, name, ext)
+	if err := blobs.Put(ctx, key, f, u.Size, contentType); err != nil {
+		config.Logger.Error("Failed to store upload", logrus.Fields{"upload_id": u.ID, "error": err})
+		return http.StatusInternalServerError, fmt.Errorf("failed to store upload")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		blobs.Delete(ctx, key)
+		return http.StatusInternalServerError, err
+	}
+	defer tx.Rollback()
+
+	var mediaID int
+	err = tx.QueryRow(`INSERT INTO property_media (property_id, kind, blob_key, content_type, size, filename)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING media_id`,
+		u.PropertyID, u.Kind, key, contentType, u.Size, u.Filename).Scan(&mediaID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE uploads SET media_id = $1, completed_at = (now() AT TIME ZONE 'UTC') WHERE upload_id = $2", mediaID, u.ID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		blobs.Delete(ctx, key)
+		return http.StatusInternalServerError, err
+	}
+
+	os.Remove(u.stagingPath())
+	invalidatePropertyCache()
+	return http.StatusNoContent, nil
+}
+
+func terminateUpload(w http.ResponseWriter, r *http.Request) {
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if !lockUpload(id) {
+		http.Error(w, "Upload is being written by another request", http.StatusLocked)
+		return
+	}
+	defer unlockUpload(id)
+
+	u, ok := loadUpload(w, r, principal)
+	if !ok {
+		return
+	}
+	if u.Completed {
+		http.Error(w, "Upload already completed, delete the media instead", http.StatusConflict)
+		return
+	}
+
+	discardUpload(u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func discardUpload(u upload) {
+	if _, err := db.Exec("DELETE FROM uploads WHERE upload_id = $1", u.ID); err != nil {
+		config.Logger.Warn("Failed to delete upload", logrus.Fields{"upload_id": u.ID, "error": err})
+	}
+	os.Remove(u.stagingPath())
+}
+
+// PurgeExpiredUploads removes uploads past their expiry and their staging
+// files. It runs every interval until the process exits.
+func PurgeExpiredUploads(interval time.Duration) {
+	for {
+		rows, err := db.Query("DELETE FROM uploads WHERE expires_at < (now() AT TIME ZONE 'UTC') RETURNING upload_id")
+		if err != nil {
+			config.Logger.Warn("Failed to purge expired uploads", logrus.Fields{"error": err})
+		} else {
+			for rows.Next() {
+				var id string
+				if rows.Scan(&id) == nil {
+					os.Remove(upload{ID: id}.stagingPath())
+				}
+			}
+			rows.Close()
+		}
+		time.Sleep(interval)
+	}
+}
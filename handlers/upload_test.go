@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	meta, err := parseUploadMetadata("filename dG91ci5tcDQ=,property_id Mw==, kind dmlkZW8=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta["filename"] != "tour.mp4" || meta["property_id"] != "3" || meta["kind"] != "video" {
+		t.Fatalf("unexpected metadata: %v", meta)
+	}
+
+	if _, err := parseUploadMetadata("filename not-base64!"); err == nil {
+		t.Fatal("expected invalid base64 to be rejected")
+	}
+}
+
+func patchChunk(offset, body string) *http.Request {
+	req := asUser(httptest.NewRequest(http.MethodPatch, "/uploads/abc", strings.NewReader(body)), 4, "agent")
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", offsetMediaType)
+	req.Header.Set("Upload-Offset", offset)
+	return req
+}
+
+func serveUpload(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/uploads/{id}", UploadHandler)
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func uploadRow(received int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"user_id", "property_id", "kind", "filename", "size", "received", "expires_at", "completed"}).
+		AddRow(4, 3, "floor_plan", "plan.pdf", 16, received, time.Now().Add(time.Hour), false)
+}
+
+func TestPatchUploadRejectsWrongOffset(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	mock.ExpectQuery("FROM uploads WHERE upload_id").
+		WithArgs("abc").
+		WillReturnRows(uploadRow(8))
+
+	rec := serveUpload(patchChunk("0", "%PDF-1.4"))
+	if rec.Code != http.StatusConflict || rec.Header().Get("Upload-Offset") != "8" {
+		t.Fatalf("expected 409 with offset 8, got %d %q", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+}
+
+func TestPatchUploadResumesAndCompletes(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	if err := InitUploads(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// The first 8 bytes arrived before the connection dropped.
+	staging := upload{ID: "abc"}.stagingPath()
+	if err := os.WriteFile(staging, []byte("%PDF-1.4"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectQuery("FROM uploads WHERE upload_id").
+		WithArgs("abc").
+		WillReturnRows(uploadRow(8))
+	mock.ExpectExec("UPDATE uploads SET received").
+		WithArgs(int64(16), "abc", int64(8)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO property_media").
+		WithArgs(3, "floor_plan", sqlmock.AnyArg(), "application/pdf", int64(16), "plan.pdf").
+		WillReturnRows(sqlmock.NewRows([]string{"media_id"}).AddRow(11))
+	mock.ExpectExec("UPDATE uploads SET media_id").
+		WithArgs(11, "abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rec := serveUpload(patchChunk("8", "\n%%EOF\n\n"))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "16" {
+		t.Fatalf("expected 204 with offset 16, got %d %q: %s", rec.Code, rec.Header().Get("Upload-Offset"), rec.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Fatal("expected the staging file to be removed")
+	}
+}
+
+func TestWriteChunkRejectsOverflow(t *testing.T) {
+	if err := InitUploads(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	u := upload{ID: "overflow", Size: 4}
+	os.WriteFile(u.stagingPath(), nil, 0o600)
+
+	n, err := writeChunk(u, strings.NewReader("123456"))
+	if n != 4 || err == nil {
+		t.Fatalf("expected 4 bytes and an error, got %d, %v", n, err)
+	}
+}
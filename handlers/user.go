@@ -2,13 +2,12 @@ package handlers
 
 import (
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
-	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/imaging"
 	"github.com/prem0x01/propertyAPI/models"
 	"github.com/prem0x01/propertyAPI/utils"
 )
@@ -47,13 +46,23 @@ func viewUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !canManageUser(principal, id) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	rows, err := db.Query(`
 		SELECT
-			u.user_id, u.name, u.email, u.mobile, u.aadhaar, u.u_address, u.upf_img,
-			p.property_id, p.type, p.p_address, p.prize, p.map_link, p.img
+			u.user_id, u.name, u.email, u.mobile, u.aadhaar, u.u_address, u.role, u.upf_img_key,
+			COALESCE(p.property_id, 0), COALESCE(p.type, ''), COALESCE(p.p_address, ''), COALESCE(p.prize, 0),
+			COALESCE(p.listing_kind, ''), p.monthly_rent, COALESCE(p.map_link, ''), p.img_key, COALESCE(p.status, '')
 		FROM users u
 		LEFT JOIN properties p ON u.user_id = p.user_id
 		WHERE u.user_id = $1
@@ -66,18 +75,23 @@ func viewUser(w http.ResponseWriter, r *http.Request) {
 
 	var user models.User
 	var properties []models.Property
-	var imageData []byte
+	var userImgKey sql.NullString
 
 	for rows.Next() {
 		var property models.Property
-		if err := rows.Scan(&user.UserID, &user.Name, &user.Email, &user.Mobile, &user.Aadhaar, &user.UAddress, &imageData,
-			&property.PropertyID, &property.Type, &property.PAddress, &property.Prize, &property.MapLink, &property.Img); err != nil {
+		var propertyImgKey sql.NullString
+		var monthlyRent sql.NullFloat64
+		if err := rows.Scan(&user.UserID, &user.Name, &user.Email, &user.Mobile, &user.Aadhaar, &user.UAddress, &user.Role, &userImgKey,
+			&property.PropertyID, &property.Type, &property.PAddress, &property.Prize,
+			&property.ListingKind, &monthlyRent, &property.MapLink, &propertyImgKey, &property.Status); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		user.UPFImg = imageData
-		user.UPFImgBase64 = base64.StdEncoding.EncodeToString(imageData)
+		user.UPFImgURL = blobURL(userImgKey)
+		property.ImgURL = blobURL(propertyImgKey)
+		property.ThumbURL = renditionURL(propertyImgKey, imaging.Thumb)
+		property.MonthlyRent = nullFloat(monthlyRent)
 
 		if property.PropertyID != 0 {
 			properties = append(properties, property)
@@ -97,7 +111,7 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, _, err := r.FormFile("upf_img")
+	file, header, err := r.FormFile("upf_img")
 	if err != nil && err != http.ErrMissingFile {
 		http.Error(w, "Error retrieving file", http.StatusBadRequest)
 		return
@@ -108,15 +122,6 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	var fileBytes []byte
-	if file != nil {
-		fileBytes, err = io.ReadAll(file)
-		if err != nil {
-			http.Error(w, "Error reading file", http.StatusInternalServerError)
-			return
-		}
-	}
-
 	var u models.User
 
 	u.Name = r.FormValue("name")
@@ -125,7 +130,9 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 	u.Password = r.FormValue("password")
 	u.Aadhaar, _ = strconv.ParseInt(r.FormValue("aadhaar"), 10, 64)
 	u.UAddress = r.FormValue("u_address")
-	u.UPFImg = fileBytes
+	// Signup is anonymous, so every account starts as a buyer. Buyers can
+	// become owners through PUT /user/{id}; other roles are up to an admin.
+	u.Role = models.RoleBuyer
 
 	hashPass, err := utils.HashPassword(u.Password)
 	if err != nil {
@@ -138,21 +145,37 @@ func addUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var imgKey sql.NullString
+	if file != nil {
+		if imgKey.String, err = storeUpload(r.Context(), "users", file, header); err != nil {
+			if status := uploadStatus(err); status != http.StatusInternalServerError {
+				http.Error(w, err.Error(), status)
+				return
+			}
+			http.Error(w, "Error storing file", http.StatusInternalServerError)
+			return
+		}
+		imgKey.Valid = true
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	// Use QueryRow().Scan() with RETURNING to get inserted user_id
 	err = db.QueryRow(`
-		INSERT INTO users (name, email, mobile, password, aadhaar, u_address, upf_img)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO users (name, email, mobile, password, aadhaar, u_address, upf_img_key, role)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING user_id
-	`, u.Name, u.Email, u.Mobile, hashPass, u.Aadhaar, u.UAddress, u.UPFImg).Scan(&u.UserID)
+	`, u.Name, u.Email, u.Mobile, hashPass, u.Aadhaar, u.UAddress, imgKey, u.Role).Scan(&u.UserID)
 
 	if err != nil {
+		deleteBlob(r.Context(), imgKey.String)
 		http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	u.UPFImgURL = blobURL(imgKey)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
 }
@@ -166,6 +189,15 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !canManageUser(principal, userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	var u models.User
 	err = json.NewDecoder(r.Body).Decode(&u)
 	if err != nil {
@@ -183,11 +215,41 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if u.Role != "" && !models.IsValidRole(u.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	// Store the hash, otherwise the user can no longer log in after an update.
+	hashPass, err := utils.HashPassword(u.Password)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	if u.Role != "" {
+		var current string
+		err := db.QueryRow("SELECT role FROM users WHERE user_id = $1", userID).Scan(&current)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No user found with the given ID", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !canAssignRole(principal, current, u.Role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
 	stmt, err := db.Prepare(`UPDATE users
-		SET name=$1, email=$2, mobile=$3, password=$4, aadhaar=$5, u_address=$6, upf_img=$7
+		SET name=$1, email=$2, mobile=$3, password=$4, aadhaar=$5, u_address=$6,
+			role=COALESCE(NULLIF($7, ''), role)
 		WHERE user_id=$8`)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -195,7 +257,7 @@ func updateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(u.Name, u.Email, u.Mobile, u.Password, u.Aadhaar, u.UAddress, u.UPFImg, userID)
+	result, err := stmt.Exec(u.Name, u.Email, u.Mobile, hashPass, u.Aadhaar, u.UAddress, u.Role, userID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -225,9 +287,24 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	principal, ok := currentPrincipal(w, r)
+	if !ok {
+		return
+	}
+	if !canManageUser(principal, userID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	mutex.Lock()
 	defer mutex.Unlock()
 
+	blobKeys, err := userBlobKeys(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	stmt, err := db.Prepare("DELETE FROM users WHERE user_id = $1")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -252,5 +329,34 @@ func deleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, key := range blobKeys {
+		deleteBlob(r.Context(), key)
+	}
+	invalidatePropertyCache()
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// userBlobKeys lists the profile image of a user and the images and media of
+// their properties, which go with the user row through ON DELETE CASCADE.
+func userBlobKeys(userID int) ([]string, error) {
+	rows, err := db.Query(`SELECT upf_img_key FROM users WHERE user_id = $1 AND upf_img_key IS NOT NULL
+		UNION SELECT img_key FROM properties WHERE user_id = $1 AND img_key IS NOT NULL
+		UNION SELECT i.blob_key FROM property_images i JOIN properties p ON p.property_id = i.property_id WHERE p.user_id = $1
+		UNION SELECT m.blob_key FROM property_media m JOIN properties p ON p.property_id = m.property_id WHERE p.user_id = $1`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
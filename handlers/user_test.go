@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/prem0x01/propertyAPI/storage"
+)
+
+func TestDeleteUserRemovesBlobs(t *testing.T) {
+	mock, teardown := setupMockDB(t)
+	defer teardown()
+
+	ctx := context.Background()
+	keys := []string{"users/7/avatar.jpg", "properties/3/a.jpg", "properties/3/tour.mp4"}
+	for _, key := range keys {
+		if err := blobs.Put(ctx, key, bytes.NewReader([]byte("x")), 1, "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := sqlmock.NewRows([]string{"key"})
+	for _, key := range keys {
+		rows.AddRow(key)
+	}
+	mock.ExpectQuery("SELECT upf_img_key FROM users").
+		WithArgs(7).
+		WillReturnRows(rows)
+	mock.ExpectPrepare("DELETE FROM users").
+		ExpectExec().
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := asUser(httptest.NewRequest(http.MethodDelete, "/user/7", nil), 7, "owner")
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/user/{id}", deleteUser)
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, key := range keys {
+		if _, err := blobs.Open(ctx, key); err != storage.ErrNotFound {
+			t.Errorf("expected %s to be deleted, got %v", key, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
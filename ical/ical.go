@@ -0,0 +1,117 @@
+// Package ical writes iCalendar (RFC 5545) files that calendar apps can
+// import or subscribe to.
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event statuses.
+const (
+	Tentative = "TENTATIVE"
+	Confirmed = "CONFIRMED"
+	Cancelled = "CANCELLED"
+)
+
+const (
+	prodID       = "-//propertyAPI//Appointments//EN"
+	floatLayout  = "20060102T150405"
+	utcLayout    = "20060102T150405Z"
+	maxLineBytes = 75
+)
+
+// Event is one VEVENT. Clients match updates by UID and keep the version
+// with the highest Sequence, so both must be stable for an event. Start and
+// End are written as floating times, i.e. in the viewer's own time zone.
+type Event struct {
+	UID         string
+	Sequence    int
+	Status      string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+}
+
+// Calendar is a VCALENDAR published as a whole.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// Write encodes c, stamping every event with stamp.
+func (c Calendar) Write(w io.Writer, stamp time.Time) error {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeFolded(&b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", prodID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", stamp.UTC().Format(utcLayout))
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("DTSTART", e.Start.Format(floatLayout))
+		line("DTEND", e.End.Format(floatLayout))
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escape escapes a TEXT value.
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", "",
+	).Replace(s)
+}
+
+// writeFolded writes a content line, folding it into lines of at most 75
+// bytes without splitting a UTF-8 sequence. Continuation lines start with
+// a space.
+func writeFolded(b *strings.Builder, s string) {
+	limit := maxLineBytes
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space counts towards the next line.
+		limit = maxLineBytes - 1
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,73 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteCalendar(t *testing.T) {
+	start := time.Date(2030, 6, 5, 10, 30, 0, 0, time.UTC)
+	c := Calendar{Name: "Visits", Events: []Event{{
+		UID:         "appointment-1@example",
+		Sequence:    2,
+		Status:      Cancelled,
+		Start:       start,
+		End:         start.Add(30 * time.Minute),
+		Summary:     "Visit: flat, 12 Main St; 2nd floor",
+		Description: "Booked by Asha\nStatus: cancelled",
+	}}}
+
+	var b strings.Builder
+	if err := c.Write(&b, time.Date(2030, 6, 1, 8, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:appointment-1@example\r\n",
+		"DTSTAMP:20300601T080000Z\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20300605T103000\r\n",
+		"DTEND:20300605T110000\r\n",
+		"STATUS:CANCELLED\r\n",
+		`SUMMARY:Visit: flat\, 12 Main St\; 2nd floor` + "\r\n",
+		`DESCRIPTION:Booked by Asha\nStatus: cancelled` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "LOCATION") {
+		t.Error("empty location should be left out")
+	}
+}
+
+func TestWriteFoldedKeepsLinesShortAndRunesWhole(t *testing.T) {
+	var b strings.Builder
+	long := "SUMMARY:" + strings.Repeat("é", 100)
+	writeFolded(&b, long)
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n")
+	if len(lines) < 3 {
+		t.Fatalf("expected the line to be folded, got %d lines", len(lines))
+	}
+	var joined strings.Builder
+	for i, l := range lines {
+		if len(l) > maxLineBytes {
+			t.Errorf("line %d is %d bytes long", i, len(l))
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, " ") {
+				t.Fatalf("continuation line %d does not start with a space", i)
+			}
+			l = l[1:]
+		}
+		joined.WriteString(l)
+	}
+	if joined.String() != long {
+		t.Fatal("unfolding does not give back the original line")
+	}
+}
@@ -0,0 +1,198 @@
+// Package imaging validates uploaded photos and produces the renditions that
+// are served to clients. Every image is decoded and re-encoded, which drops
+// EXIF, GPS and any other metadata the camera or phone embedded.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// Size names a rendition.
+type Size string
+
+const (
+	Thumb  Size = "thumb"
+	Medium Size = "medium"
+	Large  Size = "large"
+)
+
+// Sizes lists every rendition generated for an upload, smallest first.
+var Sizes = []Size{Thumb, Medium, Large}
+
+// maxEdge is the longest side of each rendition in pixels. Smaller images are
+// never upscaled.
+var maxEdge = map[Size]int{
+	Thumb:  320,
+	Medium: 800,
+	Large:  1600,
+}
+
+// maxPixels guards against decompression bombs: the header is checked before
+// the image is decoded.
+const maxPixels = 50_000_000
+
+const jpegQuality = 85
+
+var (
+	ErrUnsupported = errors.New("unsupported image type, expected JPEG, PNG or WebP")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Encoded is an image ready to be written to the blob store.
+type Encoded struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Result holds the cleaned original and its renditions.
+type Result struct {
+	Original   Encoded
+	Renditions map[Size]Encoded
+}
+
+// Process sniffs data, decodes it, applies the EXIF orientation and returns a
+// metadata free original plus every rendition. PNG originals stay PNG so
+// transparency survives; everything else, and every rendition, is JPEG.
+func Process(data []byte) (*Result, error) {
+	img, contentType, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Renditions: make(map[Size]Encoded, len(Sizes))}
+	if contentType == "image/png" {
+		res.Original, err = encodePNG(img)
+	} else {
+		res.Original, err = encodeJPEG(img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, size := range Sizes {
+		if res.Renditions[size], err = encodeJPEG(fit(img, maxEdge[size], maxEdge[size])); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Resize scales data to fit inside width x height (0 leaves that side
+// unbounded) and encodes it as format, "jpeg" or "png". An empty format keeps
+// PNG sources as PNG and turns everything else into JPEG.
+func Resize(data []byte, width, height int, format string) (Encoded, error) {
+	img, contentType, err := decode(data)
+	if err != nil {
+		return Encoded{}, err
+	}
+	if width > 0 || height > 0 {
+		img = fit(img, width, height)
+	}
+
+	if format == "" && contentType == "image/png" || format == "png" {
+		return encodePNG(img)
+	}
+	return encodeJPEG(img)
+}
+
+// decode sniffs and decodes data, rejecting anything but JPEG, PNG and WebP,
+// and returns the image upright.
+func decode(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+
+	var decodeImage func([]byte) (image.Image, error)
+	var decodeConfig func([]byte) (image.Config, error)
+	switch contentType {
+	case "image/jpeg":
+		decodeImage = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+	case "image/png":
+		decodeImage = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+	case "image/webp":
+		decodeImage = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+	default:
+		return nil, "", ErrUnsupported
+	}
+
+	cfg, err := decodeConfig(data)
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	img, err := decodeImage(data)
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, contentType, nil
+}
+
+// RenditionKey derives the blob key of a rendition from the key of the
+// original, so "properties/3/ab12.png" has "properties/3/ab12_thumb.jpg".
+func RenditionKey(key string, size Size) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + string(size) + ".jpg"
+}
+
+// fit scales img down, keeping its aspect ratio, so it is at most maxW wide
+// and maxH high. A zero bound is ignored.
+func fit(img image.Image, maxW, maxH int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxW > 0 && w > maxW {
+		scale = float64(maxW) / float64(w)
+	}
+	if maxH > 0 && h > maxH {
+		scale = min(scale, float64(maxH)/float64(h))
+	}
+	if scale == 1 {
+		return img
+	}
+	w = max(1, int(float64(w)*scale+0.5))
+	h = max(1, int(float64(h)*scale+0.5))
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func encodeJPEG(img image.Image) (Encoded, error) {
+	// JPEG has no alpha channel, so transparent areas are flattened onto white
+	// instead of turning black.
+	b := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: ".jpg"}, nil
+}
+
+func encodePNG(img image.Image) (Encoded, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), ContentType: "image/png", Ext: ".png"}, nil
+}
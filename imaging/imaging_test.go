@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+)
+
+// exifOrientation builds an APP1 segment holding only the orientation tag.
+func exifOrientation(v byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD0 at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, v, 0, 0, // orientation, SHORT, count 1
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	n := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(n >> 8), byte(n)}, payload...)
+}
+
+func testJPEG(t *testing.T, w, h int, orientation byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if orientation == 0 {
+		return data
+	}
+	return append(append([]byte{0xFF, 0xD8}, exifOrientation(orientation)...), data[2:]...)
+}
+
+func TestProcessAppliesOrientationAndStripsExif(t *testing.T) {
+	data := testJPEG(t, 400, 200, 6)
+	if got := jpegOrientation(data); got != 6 {
+		t.Fatalf("expected orientation 6, got %d", got)
+	}
+
+	res, err := Process(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(res.Original.Data, []byte("Exif")) {
+		t.Fatal("original still carries EXIF")
+	}
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(res.Original.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 200 || cfg.Height != 400 {
+		t.Fatalf("expected a 200x400 upright image, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(res.Renditions[Thumb].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if thumb.Width != 160 || thumb.Height != 320 {
+		t.Fatalf("unexpected thumbnail size %dx%d", thumb.Width, thumb.Height)
+	}
+
+	large, _ := jpeg.DecodeConfig(bytes.NewReader(res.Renditions[Large].Data))
+	if large.Width != 200 || large.Height != 400 {
+		t.Fatalf("large rendition should not upscale, got %dx%d", large.Width, large.Height)
+	}
+}
+
+func TestProcessRejectsOtherFormats(t *testing.T) {
+	var buf bytes.Buffer
+	gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 4, 4), []color.Color{color.Black}), nil)
+
+	for _, data := range [][]byte{buf.Bytes(), []byte("<svg></svg>"), {0xFF, 0xD8, 0xFF, 0xE0}} {
+		if _, err := Process(data); err != ErrUnsupported {
+			t.Errorf("expected ErrUnsupported, got %v", err)
+		}
+	}
+}
+
+func TestRenditionKey(t *testing.T) {
+	if got := RenditionKey("properties/3/ab12.png", Thumb); got != "properties/3/ab12_thumb.jpg" {
+		t.Fatalf("unexpected key %q", got)
+	}
+}
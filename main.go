@@ -4,14 +4,23 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prem0x01/propertyAPI/config"
 	"github.com/prem0x01/propertyAPI/handlers"
+	"github.com/prem0x01/propertyAPI/middleware"
+	"github.com/prem0x01/propertyAPI/migrations"
 	"github.com/prem0x01/propertyAPI/utils"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	router := mux.NewRouter()
 	config.InitLogger()
 	db, err := config.ConnectDB()
@@ -20,23 +29,96 @@ func main() {
 	}
 	defer db.Close()
 
-	//config.CreateTables()
+	pending, err := migrations.Pending(db)
+	if err != nil {
+		log.Fatalf("\033[31m[-] Schema check failed: %v\033[0m", err)
+	}
+	if pending > 0 {
+		log.Fatalf("\033[31m[-] %d pending migration(s), run `propertyAPI migrate up` first\033[0m", pending)
+	}
+
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		log.Fatal("\033[31m[-] JWT_SECRET is not set\033[0m")
+	}
+	auth := middleware.Authenticate(jwtSecret)
+
+	store, err := config.NewBlobStore()
+	if err != nil {
+		log.Fatalf("\033[31m[-] Failed to set up blob store: %v\033[0m", err)
+	}
+	handlers.InitBlobStore(store)
+	handlers.InitImageCache(config.ImageCacheDir(), config.ImageCacheMaxBytes())
+	if err := handlers.InitUploads(config.UploadDir()); err != nil {
+		log.Fatalf("\033[31m[-] Failed to create the upload directory: %v\033[0m", err)
+	}
+
+	handlers.InitNotifier(config.NewDispatcher())
 
+	handlers.InitAuthHandler(db, jwtSecret)
 	handlers.InitUserHandler(db)
 	handlers.InitPropertyHandler(db)
 	handlers.InitAppointmentHandler(db)
 
+	// Background jobs query the handlers' database, so they start only once
+	// it is set.
+	go handlers.PurgeExpiredUploads(time.Hour)
+	go handlers.RunAlertMatcher()
+	go handlers.SendAlertDigests(time.Hour)
+
 	fs := http.FileServer(http.Dir("static"))
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
+	router.Handle("/images/{key:.+}", utils.RateLimiter(http.HandlerFunc(handlers.ImageHandler))).Methods("GET", "HEAD")
+
+	router.Handle("/auth/login", utils.RateLimiter(http.HandlerFunc(handlers.LoginHandler))).Methods("POST")
+	router.Handle("/auth/refresh", utils.RateLimiter(http.HandlerFunc(handlers.RefreshHandler))).Methods("POST")
+	router.Handle("/auth/logout", utils.RateLimiter(http.HandlerFunc(handlers.LogoutHandler))).Methods("POST")
+
+	// Registration stays public, everything else needs a bearer token.
+	router.Handle("/user", utils.RateLimiter(http.HandlerFunc(handlers.UserHandler))).Methods("POST")
+	router.Handle("/user", utils.RateLimiter(auth(http.HandlerFunc(handlers.UserHandler)))).Methods("GET")
+	router.Handle("/user/{id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.UserHandler)))).Methods("GET", "DELETE", "PUT")
+
+	router.Handle("/user/{id}/favorites", utils.RateLimiter(auth(http.HandlerFunc(handlers.FavoritesHandler)))).Methods("GET")
+	router.Handle("/user/{id}/favorites/{property_id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.FavoritesHandler)))).Methods("POST", "DELETE")
+
+	router.Handle("/user/{id}/searches", utils.RateLimiter(auth(http.HandlerFunc(handlers.SavedSearchesHandler)))).Methods("GET", "POST")
+	router.Handle("/user/{id}/searches/{search_id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.SavedSearchesHandler)))).Methods("PUT", "DELETE")
+	router.Handle("/user/{id}/alerts", utils.RateLimiter(auth(http.HandlerFunc(handlers.AlertsHandler)))).Methods("GET")
+	router.Handle("/user/{id}/alerts/{alert_id}/read", utils.RateLimiter(auth(http.HandlerFunc(handlers.AlertsHandler)))).Methods("PUT")
+
+	router.Handle("/property", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyHandler)))).Methods("GET", "POST")
+	router.Handle("/property/clusters", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyClustersHandler)))).Methods("GET")
+	router.Handle("/property/price-drops", utils.RateLimiter(auth(http.HandlerFunc(handlers.PriceDropsHandler)))).Methods("GET")
+	router.Handle("/property/{id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyHandler)))).Methods("DELETE", "PUT")
+	router.Handle("/property/{id}/{action:publish|unpublish|mark-under-offer|mark-sold|archive|restore}", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyStatusHandler)))).Methods("POST")
+	router.Handle("/property/{id}/price-history", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyPriceHistoryHandler)))).Methods("GET")
+	router.Handle("/property/{id}/availability", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyAvailabilityHandler)))).Methods("GET", "PUT")
+	router.Handle("/property/{id}/slots", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertySlotsHandler)))).Methods("GET")
+	router.Handle("/property/{id}/images", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyImagesHandler)))).Methods("GET", "POST")
+	router.Handle("/property/{id}/images/order", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyImageOrderHandler)))).Methods("PUT")
+	router.Handle("/property/{id}/images/{image_id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyImagesHandler)))).Methods("DELETE")
+	router.Handle("/property/{id}/images/{image_id}/cover", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyCoverHandler)))).Methods("PUT")
+
+	router.Handle("/property/{id}/media", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyMediaHandler)))).Methods("GET")
+	router.Handle("/property/{id}/media/{media_id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.PropertyMediaHandler)))).Methods("DELETE")
+
+	// Resumable uploads (tus). OPTIONS is protocol discovery and stays public.
+	router.Handle("/uploads", utils.RateLimiter(http.HandlerFunc(handlers.UploadsHandler))).Methods("OPTIONS")
+	router.Handle("/uploads", utils.RateLimiter(auth(http.HandlerFunc(handlers.UploadsHandler)))).Methods("POST")
+	router.Handle("/uploads/{id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.UploadHandler)))).Methods("HEAD", "PATCH", "DELETE")
 
-	router.Handle("/user", utils.RateLimiter(http.HandlerFunc(handlers.UserHandler))).Methods("GET", "POST")
-	router.Handle("/user/{id}", utils.RateLimiter(http.HandlerFunc(handlers.UserHandler))).Methods("DELETE", "PUT")
+	router.Handle("/amenities", utils.RateLimiter(auth(http.HandlerFunc(handlers.AmenitiesHandler)))).Methods("GET", "POST")
 
-	router.Handle("/property", utils.RateLimiter(http.HandlerFunc(handlers.PropertyHandler))).Methods("GET", "POST")
-	router.Handle("/property/{id}", utils.RateLimiter(http.HandlerFunc(handlers.PropertyHandler))).Methods("DELETE", "PUT")
+	router.Handle("/appointment", utils.RateLimiter(auth(http.HandlerFunc(handlers.AppointmentHandler)))).Methods("GET", "POST")
+	router.Handle("/appointment/{id:[0-9]+}.ics", utils.RateLimiter(auth(http.HandlerFunc(handlers.AppointmentICSHandler)))).Methods("GET")
+	router.Handle("/appointment/{id}", utils.RateLimiter(auth(http.HandlerFunc(handlers.AppointmentHandler)))).Methods("DELETE", "PUT")
+	router.Handle("/appointment/{id}/{action:confirm|decline|cancel|complete|no-show}", utils.RateLimiter(auth(http.HandlerFunc(handlers.AppointmentStatusHandler)))).Methods("POST")
+	router.Handle("/appointment/{id}/history", utils.RateLimiter(auth(http.HandlerFunc(handlers.AppointmentHistoryHandler)))).Methods("GET")
 
-	router.Handle("/appointment", utils.RateLimiter(http.HandlerFunc(handlers.AppointmentHandler))).Methods("GET", "POST")
-	router.Handle("/appointment/{id}", utils.RateLimiter(http.HandlerFunc(handlers.AppointmentHandler))).Methods("DELETE", "PUT")
+	// Calendar apps cannot log in; the secret token in the feed URL is the credential.
+	router.Handle("/user/{id}/calendar", utils.RateLimiter(auth(http.HandlerFunc(handlers.CalendarTokenHandler)))).Methods("POST", "DELETE")
+	router.Handle("/calendar/{token:[0-9a-f]+}.ics", utils.RateLimiter(http.HandlerFunc(handlers.CalendarFeedHandler))).Methods("GET")
 
 	fmt.Println("\033[35m[-] Server running on :9090....\033[0m")
 	log.Fatal(http.ListenAndServe("localhost:9090", router))
@@ -1,53 +1,114 @@
 package middleware
 
 import (
-	"fmt"
+	"context"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/prem0x01/propertyAPI/config"
 	"github.com/prem0x01/propertyAPI/utils"
+	"github.com/sirupsen/logrus"
 )
 
+type contextKey string
+
+const principalKey contextKey = "principal"
+
+// Principal is the authenticated caller as described by the access token.
+type Principal struct {
+	UserID int
+	Role   string
+}
+
+// isRevoked is swapped out in tests so they do not need a Redis server.
+var isRevoked = utils.IsAccessTokenRevoked
+
 func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "No authorization header")
+		claims, code, errMsg := authenticate(c.GetHeader("Authorization"), jwtSecret)
+		if errMsg != "" {
+			utils.ErrorResponse(c, code, errMsg)
 			c.Abort()
 			return
 		}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid authorization header format")
-			c.Abort()
-			return
-		}
-
-		tokenString := parts[1]
+		c.Set("user_id", int64(claims["user_id"].(float64)))
+		c.Set("role", principalFromClaims(claims).Role)
+		c.Next()
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// Authenticate is the net/http counterpart of AuthMiddleware, used by the mux
+// router. The caller is available through PrincipalFromContext.
+func Authenticate(jwtSecret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, code, errMsg := authenticate(r.Header.Get("Authorization"), jwtSecret)
+			if errMsg != "" {
+				http.Error(w, errMsg, code)
+				return
 			}
-			return []byte(jwtSecret), nil
+
+			ctx := WithPrincipal(r.Context(), principalFromClaims(claims))
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
-		if err != nil {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid token")
-			c.Abort()
-			return
-		}
+	}
+}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
 
-			c.Set("user_id", int64(claims["user_id"].(float64)))
-			c.Next()
-		} else {
-			utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid token claims")
-			c.Abort()
-			return
-		}
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+func UserIDFromContext(ctx context.Context) (int, bool) {
+	p, ok := PrincipalFromContext(ctx)
+	return p.UserID, ok
+}
+
+func principalFromClaims(claims jwt.MapClaims) Principal {
+	role, _ := claims["role"].(string)
+	return Principal{UserID: int(claims["user_id"].(float64)), Role: role}
+}
+
+func authenticate(authHeader, jwtSecret string) (jwt.MapClaims, int, string) {
+	tokenString, errMsg := bearerToken(authHeader)
+	if errMsg != "" {
+		return nil, http.StatusUnauthorized, errMsg
+	}
+
+	claims, err := utils.ParseAccessToken(tokenString, jwtSecret)
+	if err != nil {
+		return nil, http.StatusUnauthorized, "Invalid token"
+	}
+
+	jti, _ := claims["jti"].(string)
+	familyID, _ := claims["fam"].(string)
+	revoked, err := isRevoked(jti, familyID)
+	if err != nil {
+		config.Logger.Error("Failed to check token revocation", logrus.Fields{"error": err})
+		return nil, http.StatusServiceUnavailable, "Unable to verify token"
+	}
+	if revoked {
+		return nil, http.StatusUnauthorized, "Token has been revoked"
+	}
+
+	return claims, 0, ""
+}
+
+func bearerToken(authHeader string) (string, string) {
+	if authHeader == "" {
+		return "", "No authorization header"
+	}
+
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", "Invalid authorization header format"
 	}
+	return parts[1], ""
 }
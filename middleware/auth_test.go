@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prem0x01/propertyAPI/utils"
+)
+
+func stubRevocation(t *testing.T, revoked bool) {
+	orig := isRevoked
+	isRevoked = func(jti, familyID string) (bool, error) { return revoked, nil }
+	t.Cleanup(func() { isRevoked = orig })
+}
+
+func TestAuthenticate(t *testing.T) {
+	stubRevocation(t, false)
+	secret := "test-secret"
+	var gotUserID int
+
+	handler := Authenticate(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = UserIDFromContext(r.Context())
+	}))
+
+	token, err := utils.GenerateAccessToken(42, "buyer", "family", secret)
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/property", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if gotUserID != 42 {
+		t.Fatalf("expected user_id 42 in context, got %d", gotUserID)
+	}
+}
+
+func TestAuthenticateRejectsBadTokens(t *testing.T) {
+	stubRevocation(t, false)
+	handler := Authenticate("test-secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be reached")
+	}))
+
+	forged, _ := utils.GenerateAccessToken(1, "buyer", "family", "other-secret")
+	for _, header := range []string{"", "Token abc", "Bearer garbage", "Bearer " + forged} {
+		req := httptest.NewRequest(http.MethodGet, "/property", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("header %q: expected status 401, got %d", header, rec.Code)
+		}
+	}
+}
+
+func TestAuthenticateRejectsRevokedToken(t *testing.T) {
+	stubRevocation(t, true)
+	secret := "test-secret"
+
+	handler := Authenticate(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be reached")
+	}))
+
+	token, _ := utils.GenerateAccessToken(7, "buyer", "family", secret)
+	req := httptest.NewRequest(http.MethodGet, "/property", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/prem0x01/propertyAPI/config"
+	"github.com/prem0x01/propertyAPI/imaging"
+	"github.com/prem0x01/propertyAPI/migrations"
+	"github.com/prem0x01/propertyAPI/storage"
+)
+
+const migrateUsage = "usage: propertyAPI migrate [up | down [steps] | status | blobs | renditions]"
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		args = []string{"up"}
+	}
+
+	db, err := config.OpenDB()
+	if err != nil {
+		log.Fatalf("\n[-] Failed to connect to the database: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		ran, err := migrations.Up(db)
+		for _, version := range ran {
+			fmt.Printf("\033[35m[-] Applied migration %04d\033[0m\n", version)
+		}
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("\033[35m[-] Database is up to date\033[0m")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				log.Fatal(migrateUsage)
+			}
+		}
+		reverted, err := migrations.Down(db, steps)
+		for _, version := range reverted {
+			fmt.Printf("\033[35m[-] Rolled back migration %04d\033[0m\n", version)
+		}
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+
+	case "status":
+		statuses, err := migrations.List(db)
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt
+			}
+			fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, state)
+		}
+
+	case "blobs":
+		store, err := config.NewBlobStore()
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+		moved, err := migrateBlobs(db, store)
+		fmt.Printf("\033[35m[-] Moved %d image(s) to the blob store\033[0m\n", moved)
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+
+	case "renditions":
+		store, err := config.NewBlobStore()
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+		done, err := backfillRenditions(db, store)
+		fmt.Printf("\033[35m[-] Generated renditions for %d image(s)\033[0m\n", done)
+		if err != nil {
+			log.Fatalf("\033[31m[-] %v\033[0m", err)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
+
+// blobColumns lists the legacy BYTEA image columns and the key columns that
+// replace them.
+var blobColumns = []struct {
+	table, id, bytes, key, prefix string
+}{
+	{"users", "user_id", "upf_img", "upf_img_key", "users"},
+	{"properties", "property_id", "img", "img_key", "properties"},
+}
+
+// migrateBlobs copies images still stored inline to the blob store, one row
+// at a time, and clears the BYTEA column once the key is saved. It can be
+// re-run safely after a failure.
+//
+// Only images the processor accepts are moved. The blob store is served
+// publicly, so anything else stays in the database and is logged for review.
+func migrateBlobs(db *sql.DB, store storage.BlobStore) (int, error) {
+	ctx := context.Background()
+	moved := 0
+
+	for _, c := range blobColumns {
+		// Rows are walked in id order so skipped rows are not picked up again.
+		after := 0
+		for {
+			var id int
+			var data []byte
+			err := db.QueryRow(fmt.Sprintf(`SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s IS NULL AND %s > $1
+				ORDER BY %s LIMIT 1`,
+				c.id, c.bytes, c.table, c.bytes, c.key, c.id, c.id), after).Scan(&id, &data)
+			if err == sql.ErrNoRows {
+				break
+			}
+			if err != nil {
+				return moved, err
+			}
+			after = id
+
+			res, err := imaging.Process(data)
+			if err != nil {
+				log.Printf("[-] Skipping %s %d: %v (%s, %d bytes)", c.table, id, err, http.DetectContentType(data), len(data))
+				continue
+			}
+			key := fmt.Sprintf("%s/%d/legacy%s", c.prefix, id, res.Original.Ext)
+			if err := putProcessed(ctx, store, key, res); err != nil {
+				return moved, err
+			}
+			if _, err := db.Exec(fmt.Sprintf(`UPDATE %s SET %s = $1, %s = NULL WHERE %s = $2`,
+				c.table, c.key, c.bytes, c.id), key, id); err != nil {
+				return moved, err
+			}
+			if c.table == "properties" {
+				// The image becomes the cover of a gallery that does not exist yet.
+				if _, err := db.Exec(`INSERT INTO property_images (property_id, blob_key, position, is_cover)
+					SELECT $1, $2, 0, TRUE
+					WHERE NOT EXISTS (SELECT 1 FROM property_images WHERE property_id = $1)`, id, key); err != nil {
+					return moved, err
+				}
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func putProcessed(ctx context.Context, store storage.BlobStore, key string, res *imaging.Result) error {
+	put := func(key string, enc imaging.Encoded) error {
+		return store.Put(ctx, key, bytes.NewReader(enc.Data), int64(len(enc.Data)), enc.ContentType)
+	}
+	if err := put(key, res.Original); err != nil {
+		return err
+	}
+	for _, size := range imaging.Sizes {
+		if err := put(imaging.RenditionKey(key, size), res.Renditions[size]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillRenditions generates the renditions of images stored before they
+// were introduced. Originals are left untouched and images that already have
+// a thumbnail are skipped, so it can be re-run.
+func backfillRenditions(db *sql.DB, store storage.BlobStore) (int, error) {
+	ctx := context.Background()
+
+	rows, err := db.Query(`SELECT upf_img_key FROM users WHERE upf_img_key IS NOT NULL
+		UNION SELECT blob_key FROM property_images
+		UNION SELECT img_key FROM properties WHERE img_key IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, key := range keys {
+		if rc, err := store.Open(ctx, imaging.RenditionKey(key, imaging.Thumb)); err == nil {
+			rc.Close()
+			continue
+		}
+
+		rc, err := store.Open(ctx, key)
+		if err == storage.ErrNotFound {
+			log.Printf("[-] Skipping %s: original is missing", key)
+			continue
+		}
+		if err != nil {
+			return done, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return done, err
+		}
+
+		res, err := imaging.Process(data)
+		if err != nil {
+			log.Printf("[-] Skipping %s: %v", key, err)
+			continue
+		}
+		for _, size := range imaging.Sizes {
+			enc := res.Renditions[size]
+			if err := store.Put(ctx, imaging.RenditionKey(key, size), bytes.NewReader(enc.Data), int64(len(enc.Data)), enc.ContentType); err != nil {
+				return done, err
+			}
+		}
+		done++
+	}
+	return done, nil
+}
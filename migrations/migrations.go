@@ -0,0 +1,270 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// advisoryLockKey serialises concurrent deploys running migrations against the
+// same database. The value is arbitrary but must never change.
+const advisoryLockKey = 727_001
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Load returns the embedded migrations ordered by version.
+func Load() ([]Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return load(sub)
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := fileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected file %q in migrations", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(fsys, path.Clean(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, mig.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`)
+	return err
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt string
+}
+
+func applied(db *sql.DB) (map[int]appliedMigration, error) {
+	rows, err := db.Query(`SELECT version, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = a
+	}
+	return result, rows.Err()
+}
+
+// verify fails when an already applied migration was edited afterwards, which
+// would mean databases migrated before and after the edit have diverged.
+func verify(migrations []Migration, done map[int]appliedMigration) error {
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+		if a, ok := done[m.Version]; ok && a.checksum != m.Checksum {
+			return fmt.Errorf("checksum mismatch for applied migration %04d_%s", m.Version, m.Name)
+		}
+	}
+	for version := range done {
+		if !known[version] {
+			return fmt.Errorf("database has migration %04d which this binary does not know about", version)
+		}
+	}
+	return nil
+}
+
+func prepare(db *sql.DB) ([]Migration, map[int]appliedMigration, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ensureTable(db); err != nil {
+		return nil, nil, err
+	}
+	done, err := applied(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verify(migrations, done); err != nil {
+		return nil, nil, err
+	}
+	return migrations, done, nil
+}
+
+// Up applies every pending migration in order, each in its own transaction,
+// and returns the versions it applied.
+func Up(db *sql.DB) ([]int, error) {
+	migrations, done, err := prepare(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []int
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+
+		err := inTx(db, func(tx *sql.Tx) error {
+			// Another instance may have applied it while we waited for the lock.
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.Version).Scan(&exists); err != nil || exists {
+				return err
+			}
+			if _, err := tx.Exec(m.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+				m.Version, m.Name, m.Checksum)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m.Version)
+	}
+	return ran, nil
+}
+
+// Down rolls back the latest steps applied migrations and returns the
+// versions it reverted.
+func Down(db *sql.DB, steps int) ([]int, error) {
+	migrations, done, err := prepare(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []int
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+
+		err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("rollback %04d_%s: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m.Version)
+	}
+	return reverted, nil
+}
+
+func List(db *sql.DB) ([]Status, error) {
+	migrations, done, err := prepare(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		a, ok := done[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: a.appliedAt})
+	}
+	return statuses, nil
+}
+
+// Pending returns how many migrations still have to be applied. It also fails
+// on checksum mismatches, so the server refuses to boot on a drifted schema.
+func Pending(db *sql.DB) (int, error) {
+	migrations, done, err := prepare(db)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations) - len(done), nil
+}
+
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, advisoryLockKey); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
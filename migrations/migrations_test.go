@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadOrdersAndPairsScripts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b ();")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a ();")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 {
+		t.Fatalf("unexpected migrations: %+v", migrations)
+	}
+	if migrations[0].Down != "DROP TABLE a;" || migrations[0].Checksum == "" {
+		t.Fatalf("scripts not paired: %+v", migrations[0])
+	}
+}
+
+func TestLoadRejectsMissingDown(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0001_first.up.sql": {Data: []byte("CREATE TABLE a ();")},
+	}
+	if _, err := load(fsys); err == nil {
+		t.Fatal("expected an error for a migration without a down script")
+	}
+}
+
+func TestVerifyDetectsEditedMigration(t *testing.T) {
+	migrations := []Migration{{Version: 1, Name: "first", Checksum: "new"}}
+
+	if err := verify(migrations, map[int]appliedMigration{1: {checksum: "new"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := verify(migrations, map[int]appliedMigration{1: {checksum: "old"}}); err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+	if err := verify(migrations, map[int]appliedMigration{2: {checksum: "x"}}); err == nil {
+		t.Fatal("expected an error for an unknown applied migration")
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("embedded migrations are invalid: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration versions must be contiguous, got %d at position %d", m.Version, i)
+		}
+	}
+}
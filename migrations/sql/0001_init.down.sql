@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS appointments;
+DROP TABLE IF EXISTS properties;
+DROP TABLE IF EXISTS users;
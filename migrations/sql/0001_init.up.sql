@@ -0,0 +1,42 @@
+-- Baseline schema. Written with IF NOT EXISTS so databases bootstrapped by the
+-- old createTables code can adopt migrations without being recreated.
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    email VARCHAR(255) UNIQUE NOT NULL,
+    mobile VARCHAR(15) UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    aadhaar BIGINT UNIQUE NOT NULL,
+    u_address TEXT,
+    upf_img BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'buyer'
+    CHECK (role IN ('buyer', 'owner', 'agent', 'admin'));
+
+CREATE TABLE IF NOT EXISTS properties (
+    property_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    p_address TEXT NOT NULL,
+    prize DECIMAL(12,2) NOT NULL,
+    map_link TEXT,
+    img BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS appointments (
+    appointment_id SERIAL PRIMARY KEY,
+    user_id INT REFERENCES users(user_id) ON DELETE CASCADE,
+    property_id INT REFERENCES properties(property_id) ON DELETE CASCADE,
+    time TIME NOT NULL,
+    date DATE NOT NULL,
+    mobile VARCHAR(15) NOT NULL,
+    address TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS properties_type_idx;
+DROP INDEX IF EXISTS properties_user_id_idx;
+DROP INDEX IF EXISTS properties_prize_idx;
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS properties_prize_idx ON properties (prize);
+CREATE INDEX IF NOT EXISTS properties_user_id_idx ON properties (user_id);
+CREATE INDEX IF NOT EXISTS properties_type_idx ON properties (LOWER(type));
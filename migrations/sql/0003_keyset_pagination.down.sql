@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS appointments_created_at_id_idx;
+DROP INDEX IF EXISTS properties_created_at_id_idx;
+
+ALTER TABLE appointments ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE properties ALTER COLUMN created_at DROP NOT NULL;
@@ -0,0 +1,9 @@
+-- Keyset paging orders by (created_at, id), so created_at must never be NULL.
+UPDATE properties SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE properties ALTER COLUMN created_at SET NOT NULL;
+
+UPDATE appointments SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL;
+ALTER TABLE appointments ALTER COLUMN created_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS properties_created_at_id_idx ON properties (created_at DESC, property_id DESC);
+CREATE INDEX IF NOT EXISTS appointments_created_at_id_idx ON appointments (created_at DESC, appointment_id DESC);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS properties_search_vector_idx;
+ALTER TABLE properties DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE properties DROP COLUMN IF EXISTS description;
@@ -0,0 +1,12 @@
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS description TEXT;
+
+-- Weighted so matches in the type beat the address, which beat the description.
+-- The configuration must stay in sync with textSearchConfig in handlers.
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(type, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(p_address, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(description, '')), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS properties_search_vector_idx ON properties USING GIN (search_vector);
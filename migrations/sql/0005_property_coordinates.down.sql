@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS properties_coordinates_idx;
+ALTER TABLE properties DROP COLUMN IF EXISTS longitude;
+ALTER TABLE properties DROP COLUMN IF EXISTS latitude;
@@ -0,0 +1,18 @@
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION
+    CHECK (latitude BETWEEN -90 AND 90);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION
+    CHECK (longitude BETWEEN -180 AND 180);
+
+-- Backfill from Google Maps links the same way utils.ParseMapLink does for
+-- new rows: the !3d/!4d pin first, then the @lat,lng viewport centre.
+UPDATE properties
+SET latitude = (regexp_match(map_link, '!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)'))[1]::double precision,
+    longitude = (regexp_match(map_link, '!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)'))[2]::double precision
+WHERE latitude IS NULL AND map_link ~ '!3d-?\d+(\.\d+)?!4d-?\d+(\.\d+)?';
+
+UPDATE properties
+SET latitude = (regexp_match(map_link, '@(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)'))[1]::double precision,
+    longitude = (regexp_match(map_link, '@(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)'))[2]::double precision
+WHERE latitude IS NULL AND map_link ~ '@-?\d+(\.\d+)?,-?\d+(\.\d+)?';
+
+CREATE INDEX IF NOT EXISTS properties_coordinates_idx ON properties (latitude, longitude);
@@ -0,0 +1,2 @@
+ALTER TABLE properties DROP COLUMN IF EXISTS img_key;
+ALTER TABLE users DROP COLUMN IF EXISTS upf_img_key;
@@ -0,0 +1,5 @@
+-- Images move out of BYTEA into the blob store; rows only keep the key.
+-- Existing bytes are copied over by `propertyAPI migrate blobs`, the old
+-- columns are left in place until that has run everywhere.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS upf_img_key TEXT;
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS img_key TEXT;
@@ -0,0 +1,18 @@
+-- A property can have a whole gallery. properties.img_key is kept as the key
+-- of the cover image so list queries do not need to join the gallery.
+CREATE TABLE IF NOT EXISTS property_images (
+    image_id SERIAL PRIMARY KEY,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    blob_key TEXT NOT NULL,
+    position INT NOT NULL,
+    is_cover BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS property_images_property_idx ON property_images (property_id, position);
+CREATE UNIQUE INDEX IF NOT EXISTS property_images_cover_idx ON property_images (property_id) WHERE is_cover;
+
+INSERT INTO property_images (property_id, blob_key, position, is_cover)
+SELECT property_id, img_key, 0, TRUE FROM properties
+WHERE img_key IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM property_images i WHERE i.property_id = properties.property_id);
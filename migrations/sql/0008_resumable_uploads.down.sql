@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS uploads;
+DROP TABLE IF EXISTS property_media;
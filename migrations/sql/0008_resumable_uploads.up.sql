@@ -0,0 +1,31 @@
+-- Large media (walkthrough videos, floor plans) is uploaded in chunks with a
+-- tus style protocol. Chunks are staged on local disk; uploads tracks how far
+-- each one got so clients can resume after a dropped connection.
+CREATE TABLE IF NOT EXISTS property_media (
+    media_id SERIAL PRIMARY KEY,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('video', 'floor_plan')),
+    blob_key TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    filename TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS property_media_property_idx ON property_media (property_id);
+
+CREATE TABLE IF NOT EXISTS uploads (
+    upload_id TEXT PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('video', 'floor_plan')),
+    filename TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL CHECK (size > 0),
+    received BIGINT NOT NULL DEFAULT 0 CHECK (received >= 0 AND received <= size),
+    media_id INT REFERENCES property_media(media_id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS uploads_expires_idx ON uploads (expires_at);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS properties_status_created_idx;
+ALTER TABLE properties DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE properties DROP COLUMN IF EXISTS sold_at;
+ALTER TABLE properties DROP COLUMN IF EXISTS under_offer_at;
+ALTER TABLE properties DROP COLUMN IF EXISTS published_at;
+ALTER TABLE properties DROP COLUMN IF EXISTS status;
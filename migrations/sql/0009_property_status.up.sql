@@ -0,0 +1,15 @@
+-- Listings move through draft -> published -> under_offer -> sold, and can be
+-- archived. Existing rows were all visible, so they start out published; new
+-- rows default to draft. Each transition stamps its own column.
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'published', 'under_offer', 'sold', 'archived'));
+ALTER TABLE properties ALTER COLUMN status SET DEFAULT 'draft';
+
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS published_at TIMESTAMP;
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS under_offer_at TIMESTAMP;
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS sold_at TIMESTAMP;
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+
+UPDATE properties SET published_at = created_at WHERE status = 'published' AND published_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS properties_status_created_idx ON properties (status, created_at DESC, property_id DESC);
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS property_amenities;
+DROP TABLE IF EXISTS amenities;
+DROP INDEX IF EXISTS properties_area_sqft_idx;
+DROP INDEX IF EXISTS properties_bedrooms_idx;
+ALTER TABLE properties DROP COLUMN IF EXISTS area_sqft;
+ALTER TABLE properties DROP COLUMN IF EXISTS year_built;
+ALTER TABLE properties DROP COLUMN IF EXISTS parking;
+ALTER TABLE properties DROP COLUMN IF EXISTS furnishing;
+ALTER TABLE properties DROP COLUMN IF EXISTS facing;
+ALTER TABLE properties DROP COLUMN IF EXISTS total_floors;
+ALTER TABLE properties DROP COLUMN IF EXISTS floor;
+ALTER TABLE properties DROP COLUMN IF EXISTS area_unit;
+ALTER TABLE properties DROP COLUMN IF EXISTS built_up_area;
+ALTER TABLE properties DROP COLUMN IF EXISTS carpet_area;
+ALTER TABLE properties DROP COLUMN IF EXISTS bathrooms;
+ALTER TABLE properties DROP COLUMN IF EXISTS bedrooms;
@@ -0,0 +1,54 @@
+-- Structured listing attributes. area_sqft normalises whichever area was
+-- given to square feet so filters work across units.
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS bedrooms SMALLINT CHECK (bedrooms >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS bathrooms SMALLINT CHECK (bathrooms >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS carpet_area NUMERIC(10, 2) CHECK (carpet_area > 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS built_up_area NUMERIC(10, 2) CHECK (built_up_area > 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS area_unit TEXT NOT NULL DEFAULT 'sqft'
+    CHECK (area_unit IN ('sqft', 'sqm', 'sqyd'));
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS floor SMALLINT;
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS total_floors SMALLINT CHECK (total_floors >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS facing TEXT
+    CHECK (facing IN ('north', 'south', 'east', 'west', 'north_east', 'north_west', 'south_east', 'south_west'));
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS furnishing TEXT
+    CHECK (furnishing IN ('unfurnished', 'semi_furnished', 'furnished'));
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS parking SMALLINT CHECK (parking >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS year_built SMALLINT CHECK (year_built BETWEEN 1800 AND 2200);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS area_sqft NUMERIC(12, 2) GENERATED ALWAYS AS (
+    COALESCE(carpet_area, built_up_area) * CASE area_unit WHEN 'sqm' THEN 10.7639 WHEN 'sqyd' THEN 9 ELSE 1 END
+) STORED;
+
+CREATE INDEX IF NOT EXISTS properties_bedrooms_idx ON properties (bedrooms);
+CREATE INDEX IF NOT EXISTS properties_area_sqft_idx ON properties (area_sqft);
+
+CREATE TABLE IF NOT EXISTS amenities (
+    amenity_id SERIAL PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS property_amenities (
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    amenity_id INT NOT NULL REFERENCES amenities(amenity_id) ON DELETE CASCADE,
+    PRIMARY KEY (property_id, amenity_id)
+);
+
+CREATE INDEX IF NOT EXISTS property_amenities_amenity_idx ON property_amenities (amenity_id);
+
+INSERT INTO amenities (slug, name) VALUES
+    ('lift', 'Lift'),
+    ('power_backup', 'Power backup'),
+    ('security', '24x7 security'),
+    ('cctv', 'CCTV'),
+    ('gated_community', 'Gated community'),
+    ('gym', 'Gym'),
+    ('swimming_pool', 'Swimming pool'),
+    ('club_house', 'Club house'),
+    ('garden', 'Garden'),
+    ('children_play_area', 'Children''s play area'),
+    ('intercom', 'Intercom'),
+    ('visitor_parking', 'Visitor parking'),
+    ('rainwater_harvesting', 'Rainwater harvesting'),
+    ('piped_gas', 'Piped gas'),
+    ('pet_friendly', 'Pet friendly')
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS properties_kind_rent_idx;
+ALTER TABLE properties DROP CONSTRAINT IF EXISTS properties_rental_terms_check;
+ALTER TABLE properties DROP COLUMN IF EXISTS available_from;
+ALTER TABLE properties DROP COLUMN IF EXISTS min_lease_months;
+ALTER TABLE properties DROP COLUMN IF EXISTS maintenance;
+ALTER TABLE properties DROP COLUMN IF EXISTS security_deposit;
+ALTER TABLE properties DROP COLUMN IF EXISTS monthly_rent;
+ALTER TABLE properties DROP COLUMN IF EXISTS listing_kind;
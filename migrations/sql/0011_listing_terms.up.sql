@@ -0,0 +1,14 @@
+-- Listings are for sale, rent or lease. prize stays the asking price of a
+-- sale; rentals carry their own terms instead.
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS listing_kind TEXT NOT NULL DEFAULT 'sale'
+    CHECK (listing_kind IN ('sale', 'rent', 'lease'));
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS monthly_rent NUMERIC(12, 2) CHECK (monthly_rent > 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS security_deposit NUMERIC(12, 2) CHECK (security_deposit >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS maintenance NUMERIC(12, 2) CHECK (maintenance >= 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS min_lease_months SMALLINT CHECK (min_lease_months > 0);
+ALTER TABLE properties ADD COLUMN IF NOT EXISTS available_from DATE;
+
+ALTER TABLE properties ADD CONSTRAINT properties_rental_terms_check
+    CHECK (listing_kind = 'sale' OR monthly_rent IS NOT NULL);
+
+CREATE INDEX IF NOT EXISTS properties_kind_rent_idx ON properties (listing_kind, monthly_rent);
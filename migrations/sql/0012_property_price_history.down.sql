@@ -0,0 +1 @@
+DROP TABLE IF EXISTS property_price_history;
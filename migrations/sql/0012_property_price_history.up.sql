@@ -0,0 +1,23 @@
+-- Every asking price a listing has had: the sale price for sales, the monthly
+-- rent otherwise. old_price is NULL for the first price and whenever the
+-- listing kind changed, since the two are not comparable.
+CREATE TABLE IF NOT EXISTS property_price_history (
+    history_id SERIAL PRIMARY KEY,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    listing_kind TEXT NOT NULL,
+    old_price NUMERIC(12, 2),
+    new_price NUMERIC(12, 2) NOT NULL,
+    changed_by INT REFERENCES users(user_id) ON DELETE SET NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS property_price_history_property_idx ON property_price_history (property_id, changed_at);
+CREATE INDEX IF NOT EXISTS property_price_history_drops_idx ON property_price_history (changed_at DESC)
+    WHERE new_price < old_price;
+
+INSERT INTO property_price_history (property_id, listing_kind, new_price, changed_by, changed_at)
+SELECT p.property_id, p.listing_kind,
+    CASE WHEN p.listing_kind = 'sale' THEN p.prize ELSE p.monthly_rent END,
+    p.user_id, p.created_at
+FROM properties p
+WHERE NOT EXISTS (SELECT 1 FROM property_price_history h WHERE h.property_id = p.property_id);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS favorites (
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, property_id)
+);
+
+CREATE INDEX IF NOT EXISTS favorites_property_idx ON favorites (property_id);
+CREATE INDEX IF NOT EXISTS favorites_user_created_idx ON favorites (user_id, created_at DESC, property_id DESC);
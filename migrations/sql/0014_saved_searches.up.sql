@@ -0,0 +1,25 @@
+-- query is a normalised GET /property query string. Alerts are unique per
+-- search and listing so a listing that is published twice alerts once.
+CREATE TABLE IF NOT EXISTS saved_searches (
+    search_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    channel TEXT NOT NULL DEFAULT 'in_app' CHECK (channel IN ('email', 'sms', 'in_app')),
+    frequency TEXT NOT NULL DEFAULT 'instant' CHECK (frequency IN ('instant', 'daily')),
+    last_digest_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS search_alerts (
+    alert_id SERIAL PRIMARY KEY,
+    search_id INT NOT NULL REFERENCES saved_searches(search_id) ON DELETE CASCADE,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP,
+    read_at TIMESTAMP,
+    UNIQUE (search_id, property_id)
+);
+
+CREATE INDEX IF NOT EXISTS search_alerts_unsent_idx ON search_alerts (search_id) WHERE sent_at IS NULL;
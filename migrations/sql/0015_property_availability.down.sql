@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS appointments_property_date_idx;
+ALTER TABLE appointments DROP COLUMN IF EXISTS duration_minutes;
+DROP TABLE IF EXISTS property_blackouts;
+DROP TABLE IF EXISTS property_availability;
@@ -0,0 +1,24 @@
+-- Weekly visiting hours per property, in the property's wall clock time.
+-- weekday follows EXTRACT(DOW): 0 is Sunday. Properties without windows use
+-- the application default.
+CREATE TABLE IF NOT EXISTS property_availability (
+    window_id SERIAL PRIMARY KEY,
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    weekday SMALLINT NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    slot_minutes SMALLINT NOT NULL DEFAULT 30 CHECK (slot_minutes BETWEEN 15 AND 240),
+    CHECK (start_time < end_time)
+);
+
+CREATE INDEX IF NOT EXISTS property_availability_property_idx ON property_availability (property_id, weekday);
+
+CREATE TABLE IF NOT EXISTS property_blackouts (
+    property_id INT NOT NULL REFERENCES properties(property_id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (property_id, date)
+);
+
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS duration_minutes SMALLINT NOT NULL DEFAULT 30;
+CREATE INDEX IF NOT EXISTS appointments_property_date_idx ON appointments (property_id, date);
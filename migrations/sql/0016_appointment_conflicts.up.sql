@@ -0,0 +1,9 @@
+-- Visits to the same property may not overlap, whichever instance books them.
+-- Ranges are half open, so back to back slots do not conflict. Overlapping
+-- bookings made before this migration must be moved before it can run.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE appointments ADD CONSTRAINT appointments_no_overlap EXCLUDE USING gist (
+    property_id WITH =,
+    tsrange(date + time, date + time + duration_minutes * INTERVAL '1 minute') WITH &&
+);
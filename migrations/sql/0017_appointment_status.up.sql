@@ -0,0 +1,31 @@
+-- Visits move requested -> confirmed -> completed or no_show, and can be
+-- rescheduled or cancelled on the way. Existing bookings were never confirmed
+-- by their owners, so they start out requested.
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'requested'
+    CHECK (status IN ('requested', 'confirmed', 'rescheduled', 'cancelled', 'completed', 'no_show'));
+
+-- Cancelled visits free their slot.
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_no_overlap;
+ALTER TABLE appointments ADD CONSTRAINT appointments_no_overlap EXCLUDE USING gist (
+    property_id WITH =,
+    tsrange(date + time, date + time + duration_minutes * INTERVAL '1 minute') WITH &&
+) WHERE (status <> 'cancelled');
+
+-- One row per booking, status change and reschedule, holding the state the
+-- appointment was left in.
+CREATE TABLE IF NOT EXISTS appointment_history (
+    history_id SERIAL PRIMARY KEY,
+    appointment_id INT NOT NULL REFERENCES appointments(appointment_id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    date DATE NOT NULL,
+    time TIME NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    changed_by INT REFERENCES users(user_id) ON DELETE SET NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS appointment_history_appointment_idx ON appointment_history (appointment_id, changed_at);
+
+INSERT INTO appointment_history (appointment_id, to_status, date, time, changed_by, changed_at)
+SELECT appointment_id, status, date, time, user_id, created_at FROM appointments;
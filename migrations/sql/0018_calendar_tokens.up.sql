@@ -0,0 +1,7 @@
+-- Secret feed URLs for calendar apps, one per user. Only a SHA-256 of the
+-- token is kept, like refresh tokens; rotating replaces the row.
+CREATE TABLE IF NOT EXISTS calendar_tokens (
+    user_id INT PRIMARY KEY REFERENCES users(user_id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
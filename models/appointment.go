@@ -1,11 +1,61 @@
 package models
 
+const (
+	AppointmentRequested   = "requested"
+	AppointmentConfirmed   = "confirmed"
+	AppointmentRescheduled = "rescheduled"
+	AppointmentCancelled   = "cancelled"
+	AppointmentCompleted   = "completed"
+	AppointmentNoShow      = "no_show"
+)
+
+// appointmentTransitions is the visit state machine. Requested and
+// rescheduled visits wait for the owner to confirm them; cancelled, completed
+// and no-show visits are final.
+var appointmentTransitions = map[string][]string{
+	AppointmentRequested:   {AppointmentConfirmed, AppointmentRescheduled, AppointmentCancelled},
+	AppointmentConfirmed:   {AppointmentRescheduled, AppointmentCancelled, AppointmentCompleted, AppointmentNoShow},
+	AppointmentRescheduled: {AppointmentConfirmed, AppointmentRescheduled, AppointmentCancelled},
+	AppointmentCancelled:   {},
+	AppointmentCompleted:   {},
+	AppointmentNoShow:      {},
+}
+
+func IsValidAppointmentStatus(status string) bool {
+	_, ok := appointmentTransitions[status]
+	return ok
+}
+
+func CanTransitionAppointment(from, to string) bool {
+	for _, s := range appointmentTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
 type Appointment struct {
-	AppointmentID int    `json:"appointment_id"`
-	UserID        int    `json:"user_id"`
-	PropertyID    int    `json:"property_id"`
-	Time          string `json:"time"`
-	Date          string `json:"date"`
-	Mobile        string `json:"mobile"`
-	Address       string `json:"address"`
+	AppointmentID   int    `json:"appointment_id"`
+	UserID          int    `json:"user_id"`
+	PropertyID      int    `json:"property_id"`
+	Time            string `json:"time"`
+	Date            string `json:"date"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+	Status          string `json:"status,omitempty"`
+	Mobile          string `json:"mobile"`
+	Address         string `json:"address"`
+}
+
+// AppointmentChange is one entry of a visit's history: the status and slot
+// it was left in, who changed it and why. FromStatus is empty for the
+// booking itself; ChangedBy is nil once that user is deleted.
+type AppointmentChange struct {
+	FromStatus string `json:"from_status,omitempty"`
+	ToStatus   string `json:"to_status"`
+	Date       string `json:"date"`
+	Time       string `json:"time"`
+	Reason     string `json:"reason,omitempty"`
+	ChangedBy  *int   `json:"changed_by,omitempty"`
+	ChangedAt  string `json:"changed_at"`
 }
@@ -0,0 +1,32 @@
+package models
+
+// AvailabilityWindow is a weekly period in which a property can be visited,
+// split into slots of SlotMinutes. Weekday 0 is Sunday; Start and End are
+// wall clock times such as "09:30".
+type AvailabilityWindow struct {
+	Weekday     int    `json:"weekday"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	SlotMinutes int    `json:"slot_minutes"`
+}
+
+// Blackout is a date on which a property cannot be visited at all.
+type Blackout struct {
+	Date   string `json:"date"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Availability is the visiting schedule of a property. Default is set when
+// the owner has not defined windows and the standard hours apply.
+type Availability struct {
+	Windows   []AvailabilityWindow `json:"windows"`
+	Blackouts []Blackout           `json:"blackouts"`
+	Default   bool                 `json:"default"`
+}
+
+// Slot is a bookable visit; Date and Time can be sent as is to book it.
+type Slot struct {
+	Date            string `json:"date"`
+	Time            string `json:"time"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
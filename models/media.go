@@ -0,0 +1,14 @@
+package models
+
+// PropertyMedia is a large file attached to a property, such as a
+// walkthrough video or a floor plan, uploaded through /uploads.
+type PropertyMedia struct {
+	MediaID     int    `json:"media_id"`
+	PropertyID  int    `json:"property_id"`
+	Kind        string `json:"kind"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Filename    string `json:"filename,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
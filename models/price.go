@@ -0,0 +1,12 @@
+package models
+
+// PriceChange is one entry of a listing's price history. OldPrice and
+// ChangePct are unset for the first asking price and after the listing kind
+// changed.
+type PriceChange struct {
+	ListingKind string   `json:"listing_kind"`
+	OldPrice    *float64 `json:"old_price,omitempty"`
+	NewPrice    float64  `json:"new_price"`
+	ChangePct   *float64 `json:"change_pct,omitempty"`
+	ChangedAt   string   `json:"changed_at"`
+}
@@ -1,12 +1,127 @@
 package models
 
+const (
+	StatusDraft      = "draft"
+	StatusPublished  = "published"
+	StatusUnderOffer = "under_offer"
+	StatusSold       = "sold"
+	StatusArchived   = "archived"
+)
+
+const (
+	ListingSale  = "sale"
+	ListingRent  = "rent"
+	ListingLease = "lease"
+)
+
+var ListingKinds = map[string]bool{
+	ListingSale:  true,
+	ListingRent:  true,
+	ListingLease: true,
+}
+
+// AreaUnits maps the accepted area units to their size in square feet.
+var AreaUnits = map[string]float64{
+	"sqft": 1,
+	"sqm":  10.7639,
+	"sqyd": 9,
+}
+
+var Facings = map[string]bool{
+	"north": true, "south": true, "east": true, "west": true,
+	"north_east": true, "north_west": true, "south_east": true, "south_west": true,
+}
+
+var Furnishings = map[string]bool{
+	"unfurnished":    true,
+	"semi_furnished": true,
+	"furnished":      true,
+}
+
+// Amenity is an entry of the amenities catalog properties pick from.
+type Amenity struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// propertyTransitions is the listing state machine: the statuses a property
+// may move to from each status.
+var propertyTransitions = map[string][]string{
+	StatusDraft:      {StatusPublished, StatusArchived},
+	StatusPublished:  {StatusDraft, StatusUnderOffer, StatusSold, StatusArchived},
+	StatusUnderOffer: {StatusPublished, StatusSold, StatusArchived},
+	StatusSold:       {StatusArchived},
+	StatusArchived:   {StatusDraft},
+}
+
+func IsValidStatus(status string) bool {
+	_, ok := propertyTransitions[status]
+	return ok
+}
+
+// StatusesLeadingTo lists the statuses a property can be moved to status from.
+func StatusesLeadingTo(status string) []string {
+	var from []string
+	for _, s := range []string{StatusDraft, StatusPublished, StatusUnderOffer, StatusSold, StatusArchived} {
+		for _, to := range propertyTransitions[s] {
+			if to == status {
+				from = append(from, s)
+			}
+		}
+	}
+	return from
+}
+
 type Property struct {
-	PropertyID int     `json:"property_id"`
-	Type       string  `json:"type"`
-	PAddress   string  `json:"p_address"`
-	Prize      float64 `json:"prize"`
-	MapLink    string  `json:"map_link"`
-	Img        string  `json:"img_path"`
-	CreatedAt  string  `json:"created_at"`
-	UserID     int     `json:"user_id"`
+	PropertyID      int             `json:"property_id"`
+	Type            string          `json:"type"`
+	PAddress        string          `json:"p_address"`
+	Description     string          `json:"description"`
+	Prize           float64         `json:"prize"`
+	ListingKind     string          `json:"listing_kind"`
+	MonthlyRent     *float64        `json:"monthly_rent,omitempty"`
+	SecurityDeposit *float64        `json:"security_deposit,omitempty"`
+	Maintenance     *float64        `json:"maintenance,omitempty"`
+	MinLeaseMonths  *int            `json:"min_lease_months,omitempty"`
+	AvailableFrom   string          `json:"available_from,omitempty"`
+	MapLink         string          `json:"map_link"`
+	Latitude        *float64        `json:"latitude,omitempty"`
+	Longitude       *float64        `json:"longitude,omitempty"`
+	Bedrooms        *int            `json:"bedrooms,omitempty"`
+	Bathrooms       *int            `json:"bathrooms,omitempty"`
+	CarpetArea      *float64        `json:"carpet_area,omitempty"`
+	BuiltUpArea     *float64        `json:"built_up_area,omitempty"`
+	AreaUnit        string          `json:"area_unit,omitempty"`
+	Floor           *int            `json:"floor,omitempty"`
+	TotalFloors     *int            `json:"total_floors,omitempty"`
+	Facing          string          `json:"facing,omitempty"`
+	Furnishing      string          `json:"furnishing,omitempty"`
+	Parking         *int            `json:"parking,omitempty"`
+	YearBuilt       *int            `json:"year_built,omitempty"`
+	Amenities       []string        `json:"amenities,omitempty"`
+	FavoriteCount   int             `json:"favorite_count"`
+	ImgURL          string          `json:"img_url,omitempty"`
+	ThumbURL        string          `json:"thumb_url,omitempty"`
+	Images          []PropertyImage `json:"images,omitempty"`
+	Status          string          `json:"status"`
+	PublishedAt     string          `json:"published_at,omitempty"`
+	UnderOfferAt    string          `json:"under_offer_at,omitempty"`
+	SoldAt          string          `json:"sold_at,omitempty"`
+	ArchivedAt      string          `json:"archived_at,omitempty"`
+	CreatedAt       string          `json:"created_at"`
+	UserID          int             `json:"user_id"`
+}
+
+// PropertyImage is one photo of a property's gallery. Galleries are returned
+// ordered by Position; the cover is also exposed as Property.ImgURL and
+// Property.ThumbURL. List endpoints only fill in ThumbURL.
+type PropertyImage struct {
+	ImageID    int    `json:"image_id"`
+	PropertyID int    `json:"property_id"`
+	URL        string `json:"url,omitempty"`
+	ThumbURL   string `json:"thumb_url"`
+	MediumURL  string `json:"medium_url,omitempty"`
+	LargeURL   string `json:"large_url,omitempty"`
+	Position   int    `json:"position"`
+	IsCover    bool   `json:"is_cover"`
 }
@@ -0,0 +1,29 @@
+package models
+
+const (
+	FrequencyInstant = "instant"
+	FrequencyDaily   = "daily"
+)
+
+// SavedSearch is a named GET /property query the user wants to be alerted
+// about when new listings match it.
+type SavedSearch struct {
+	SearchID  int    `json:"search_id"`
+	UserID    int    `json:"user_id"`
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Channel   string `json:"channel"`
+	Frequency string `json:"frequency"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SearchAlert records that a listing matched a saved search.
+type SearchAlert struct {
+	AlertID    int      `json:"alert_id"`
+	SearchID   int      `json:"search_id"`
+	SearchName string   `json:"search_name"`
+	Property   Property `json:"property"`
+	CreatedAt  string   `json:"created_at"`
+	SentAt     string   `json:"sent_at,omitempty"`
+	ReadAt     string   `json:"read_at,omitempty"`
+}
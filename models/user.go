@@ -1,15 +1,30 @@
 package models
 
+const (
+	RoleBuyer = "buyer"
+	RoleOwner = "owner"
+	RoleAgent = "agent"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	UserID       int        `json:"user_id"`
-	Name         string     `json:"name"`
-	Email        string     `json:"email"`
-	Mobile       string     `json:"mobile"`
-	Password     string     `json:"password"`
-	Aadhaar      int64      `json:"aadhaar"`
-	UAddress     string     `json:"u_address"`
-	UPFImg       []byte     `json:"-"`
-	UPFImgBase64 string     `json:"upf_img,omitempty"`
-	Properties   []Property `json:"properties,omitempty"`
-	CreatedAt    string     `json:"created_at"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Email      string     `json:"email"`
+	Mobile     string     `json:"mobile"`
+	Password   string     `json:"password"`
+	Aadhaar    int64      `json:"aadhaar"`
+	UAddress   string     `json:"u_address"`
+	Role       string     `json:"role"`
+	UPFImgURL  string     `json:"upf_img_url,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleBuyer, RoleOwner, RoleAgent, RoleAdmin:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+// Channels a user can pick to receive alerts on.
+const (
+	Email = "email"
+	SMS   = "sms"
+	InApp = "in_app"
+)
+
+func IsValidChannel(channel string) bool {
+	switch channel {
+	case Email, SMS, InApp:
+		return true
+	}
+	return false
+}
+
+// Message is one notification. To is the address on the channel, e.g. an
+// email address or a mobile number.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender delivers messages over one channel.
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Dispatcher routes a message to the sender registered for its channel.
+type Dispatcher map[string]Sender
+
+func (d Dispatcher) Send(ctx context.Context, channel string, m Message) error {
+	s, ok := d[channel]
+	if !ok {
+		return fmt.Errorf("no sender for channel %q", channel)
+	}
+	return s.Send(ctx, m)
+}
+
+// Discard drops every message. In-app notifications are read straight from
+// the database, so there is nothing to deliver.
+type Discard struct{}
+
+func (Discard) Send(ctx context.Context, m Message) error {
+	return nil
+}
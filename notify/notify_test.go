@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDispatcherRejectsUnknownChannel(t *testing.T) {
+	d := Dispatcher{InApp: Discard{}}
+	if err := d.Send(context.Background(), InApp, Message{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Send(context.Background(), SMS, Message{}); err == nil {
+		t.Fatal("expected an error for a channel without sender")
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.To == "fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	s := WebhookSender{URL: srv.URL}
+	if err := s.Send(context.Background(), Message{To: "+919800000000", Body: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if got.To != "+919800000000" || got.Body != "hi" {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	if err := s.Send(context.Background(), Message{To: "fail"}); err == nil {
+		t.Fatal("expected an error for a failed delivery")
+	}
+}
+
+func TestSMTPSenderRejectsHeaderInjection(t *testing.T) {
+	s := SMTPSender{Addr: "127.0.0.1:1", From: "alerts@example.com"}
+	if err := s.Send(context.Background(), Message{To: "a@example.com\r\nBcc: b@example.com"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
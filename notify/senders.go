@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LogSender only logs messages. It stands in for channels without a provider
+// configured, e.g. in development.
+type LogSender struct {
+	Channel string
+	Logger  logrus.FieldLogger
+}
+
+func (s LogSender) Send(ctx context.Context, m Message) error {
+	s.Logger.WithFields(logrus.Fields{"channel": s.Channel, "to": m.To, "subject": m.Subject}).Info("Notification not delivered, no provider configured")
+	return nil
+}
+
+// SMTPSender sends plain text email through an SMTP relay.
+type SMTPSender struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func (s SMTPSender) Send(ctx context.Context, m Message) error {
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + m.To + "\r\n" +
+		"Subject: " + m.Subject + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		m.Body
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{m.To}, []byte(msg))
+}
+
+// WebhookSender POSTs messages as JSON to a gateway, which is how most SMS
+// providers are integrated.
+type WebhookSender struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSender) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Cursor marks a position in a feed ordered by (created_at, id). Backward
+// cursors page towards newer rows.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"id"`
+	Backward  bool      `json:"b,omitempty"`
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor returns an opaque, URL safe token for c.
+func EncodeCursor(c Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID < 1 || c.CreatedAt.IsZero() {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
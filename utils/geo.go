@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const earthRadiusKm = 6371.0
+
+type LatLng struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// BoundingBox follows the GeoJSON order: west, south, east, north. West may be
+// greater than east for boxes crossing the antimeridian.
+type BoundingBox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+var (
+	ErrInvalidLatLng = errors.New("invalid coordinates, expected lat,lng")
+	ErrInvalidBBox   = errors.New("invalid bbox, expected west,south,east,north")
+
+	// !3d<lat>!4d<lng> is the dropped pin, @<lat>,<lng> only the viewport
+	// centre, so the former wins when a link carries both.
+	mapsPinPattern    = regexp.MustCompile(`!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)`)
+	mapsCenterPattern = regexp.MustCompile(`@(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)`)
+)
+
+func ValidLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+// ParseLatLng parses "lat,lng".
+func ParseLatLng(s string) (LatLng, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return LatLng{}, ErrInvalidLatLng
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	lng, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err1 != nil || err2 != nil || !ValidLatLng(lat, lng) {
+		return LatLng{}, ErrInvalidLatLng
+	}
+	return LatLng{Lat: lat, Lng: lng}, nil
+}
+
+// ParseBBox parses "west,south,east,north".
+func ParseBBox(s string) (BoundingBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, ErrInvalidBBox
+	}
+
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return BoundingBox{}, ErrInvalidBBox
+		}
+		v[i] = f
+	}
+
+	box := BoundingBox{West: v[0], South: v[1], East: v[2], North: v[3]}
+	if !ValidLatLng(box.South, box.West) || !ValidLatLng(box.North, box.East) || box.South > box.North {
+		return BoundingBox{}, ErrInvalidBBox
+	}
+	return box, nil
+}
+
+// ParseMapLink extracts coordinates from the common Google Maps link shapes:
+// place links with !3d/!4d or @lat,lng and search links with q, query, ll or
+// destination parameters. Short links (maps.app.goo.gl) carry no coordinates.
+func ParseMapLink(link string) (LatLng, bool) {
+	for _, re := range []*regexp.Regexp{mapsPinPattern, mapsCenterPattern} {
+		if m := re.FindStringSubmatch(link); m != nil {
+			if p, err := ParseLatLng(m[1] + "," + m[2]); err == nil {
+				return p, true
+			}
+		}
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return LatLng{}, false
+	}
+	q := u.Query()
+	for _, key := range []string{"q", "query", "ll", "destination", "center"} {
+		if p, err := ParseLatLng(q.Get(key)); err == nil {
+			return p, true
+		}
+	}
+	return LatLng{}, false
+}
+
+// HaversineKm is the great circle distance between two points.
+func HaversineKm(a, b LatLng) float64 {
+	dLat := toRadians(b.Lat - a.Lat)
+	dLng := toRadians(b.Lng - a.Lng)
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(toRadians(a.Lat))*math.Cos(toRadians(b.Lat))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// BoundsAround returns a box enclosing the circle of radiusKm around p. It is
+// used as a cheap, index friendly pre-filter before the exact distance check.
+func BoundsAround(p LatLng, radiusKm float64) BoundingBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	dLng := 180.0
+	if c := math.Cos(toRadians(p.Lat)); c > 1e-6 {
+		dLng = math.Min(dLat/c, 180)
+	}
+
+	box := BoundingBox{
+		West:  p.Lng - dLng,
+		South: math.Max(p.Lat-dLat, -90),
+		East:  p.Lng + dLng,
+		North: math.Min(p.Lat+dLat, 90),
+	}
+	if dLng >= 180 {
+		box.West, box.East = -180, 180
+	} else {
+		box.West = wrapLng(box.West)
+		box.East = wrapLng(box.East)
+	}
+	return box
+}
+
+func wrapLng(lng float64) float64 {
+	if lng < -180 {
+		return lng + 360
+	}
+	if lng > 180 {
+		return lng - 360
+	}
+	return lng
+}
+
+func toRadians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMapLink(t *testing.T) {
+	cases := []struct {
+		link     string
+		lat, lng float64
+		ok       bool
+	}{
+		{"https://www.google.com/maps/place/Baner/@18.5590,73.7868,15z", 18.5590, 73.7868, true},
+		{"https://www.google.com/maps/place/X/@18.55,73.78,15z/data=!3m1!4b1!4m6!3m5!3d18.5642!4d73.7769", 18.5642, 73.7769, true},
+		{"https://maps.google.com/?q=18.5204,73.8567", 18.5204, 73.8567, true},
+		{"https://www.google.com/maps/search/?api=1&query=-33.8688,151.2093", -33.8688, 151.2093, true},
+		{"https://maps.app.goo.gl/abc123", 0, 0, false},
+		{"https://maps.google.com/?q=95.0,73.0", 0, 0, false},
+	}
+
+	for _, c := range cases {
+		p, ok := ParseMapLink(c.link)
+		if ok != c.ok || (ok && (p.Lat != c.lat || p.Lng != c.lng)) {
+			t.Errorf("ParseMapLink(%q) = %+v, %v", c.link, p, ok)
+		}
+	}
+}
+
+func TestHaversineKm(t *testing.T) {
+	pune := LatLng{Lat: 18.5204, Lng: 73.8567}
+	mumbai := LatLng{Lat: 19.0760, Lng: 72.8777}
+
+	if d := HaversineKm(pune, mumbai); math.Abs(d-120) > 2 {
+		t.Fatalf("expected about 120 km between Pune and Mumbai, got %.1f", d)
+	}
+}
+
+func TestBoundsAroundContainsCircle(t *testing.T) {
+	center := LatLng{Lat: 18.5204, Lng: 73.8567}
+	box := BoundsAround(center, 5)
+
+	east := LatLng{Lat: center.Lat, Lng: box.East}
+	north := LatLng{Lat: box.North, Lng: center.Lng}
+	if HaversineKm(center, east) < 4.999 || HaversineKm(center, north) < 4.999 {
+		t.Fatalf("box %+v does not enclose a 5 km radius", box)
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	if _, err := ParseBBox("73.7,18.4,73.9,18.6"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, raw := range []string{"1,2,3", "a,b,c,d", "73.7,18.6,73.9,18.4", "0,-91,1,1"} {
+		if _, err := ParseBBox(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
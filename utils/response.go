@@ -19,6 +19,18 @@ type PaginatedResponse struct {
 	Page       int         `json:"page"`
 	PageSize   int         `json:"page_size"`
 	TotalPages int         `json:"total_pages"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	PrevCursor string      `json:"prev_cursor,omitempty"`
+}
+
+func NewPaginatedResponse(items interface{}, total int64, page, pageSize int) PaginatedResponse {
+	return PaginatedResponse{
+		Items:      items,
+		TotalItems: total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (int(total) + pageSize - 1) / pageSize,
+	}
 }
 
 func SuccessResponse(c *gin.Context, data interface{}) {
@@ -36,16 +48,8 @@ func ErrorResponse(c *gin.Context, code int, message string) {
 }
 
 func PaginatedSuccessResponse(c *gin.Context, items interface{}, total int64, page, pageSize int) {
-	totalPages := (int(total) + pageSize - 1) / pageSize
-
 	c.JSON(http.StatusOK, Response{
 		Status: "success",
-		Data: PaginatedResponse{
-			Items:      items,
-			TotalItems: total,
-			Page:       page,
-			PageSize:   pageSize,
-			TotalPages: totalPages,
-		},
+		Data:   NewPaginatedResponse(items, total, page, pageSize),
 	})
 }
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prem0x01/propertyAPI/config"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+type refreshRecord struct {
+	UserID   int    `json:"user_id"`
+	FamilyID string `json:"family_id"`
+}
+
+// Refresh tokens are opaque random strings. Redis only ever sees their SHA-256
+// so a leaked keyspace dump cannot be replayed.
+func refreshKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "refresh:" + hex.EncodeToString(sum[:])
+}
+
+func IssueRefreshToken(userID int, familyID string) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	record, _ := json.Marshal(refreshRecord{UserID: userID, FamilyID: familyID})
+	if err := config.RedisClient.Set(refreshKey(token), record, RefreshTokenTTL).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken consumes a refresh token. Each token may be used exactly
+// once; presenting an already used token means it was stolen, so the whole
+// family is revoked and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(token string) (int, string, error) {
+	key := refreshKey(token)
+
+	data, err := config.RedisClient.Get(key).Bytes()
+	if err == redis.Nil {
+		return 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	var record refreshRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	revoked, err := config.RedisClient.Exists(familyRevokedKey(record.FamilyID)).Result()
+	if err != nil {
+		return 0, "", err
+	}
+	if revoked > 0 {
+		return 0, "", ErrInvalidRefreshToken
+	}
+
+	firstUse, err := config.RedisClient.SetNX(key+":used", 1, RefreshTokenTTL).Result()
+	if err != nil {
+		return 0, "", err
+	}
+	if !firstUse {
+		if err := RevokeTokenFamily(record.FamilyID); err != nil {
+			return 0, "", err
+		}
+		return 0, "", ErrRefreshTokenReused
+	}
+
+	return record.UserID, record.FamilyID, nil
+}
+
+// LookupRefreshToken returns the family of a refresh token without consuming it.
+func LookupRefreshToken(token string) (string, error) {
+	data, err := config.RedisClient.Get(refreshKey(token)).Bytes()
+	if err == redis.Nil {
+		return "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var record refreshRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return "", ErrInvalidRefreshToken
+	}
+	return record.FamilyID, nil
+}
+
+func RevokeTokenFamily(familyID string) error {
+	return config.RedisClient.Set(familyRevokedKey(familyID), 1, RefreshTokenTTL).Err()
+}
+
+// RevokeAccessToken blacklists a single access token until it would have
+// expired anyway.
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return config.RedisClient.Set("revoked:jti:"+jti, 1, ttl).Err()
+}
+
+func IsAccessTokenRevoked(jti, familyID string) (bool, error) {
+	n, err := config.RedisClient.Exists("revoked:jti:"+jti, familyRevokedKey(familyID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func familyRevokedKey(familyID string) string {
+	return "revoked:family:" + familyID
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prem0x01/propertyAPI/config"
+)
+
+// fakeRedis speaks just enough of the Redis protocol for the session store:
+// GET, SET (with EX/PX and NX) and EXISTS. Expiry is ignored.
+type fakeRedis struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func startFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{data: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	prev := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: ln.Addr().String()})
+	t.Cleanup(func() {
+		config.RedisClient.Close()
+		config.RedisClient = prev
+		ln.Close()
+	})
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		v, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		for _, opt := range args[3:] {
+			if _, exists := f.data[args[1]]; strings.ToUpper(opt) == "NX" && exists {
+				return "$-1\r\n"
+			}
+		}
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "EXISTS":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRotateRefreshTokenIsOneTime(t *testing.T) {
+	startFakeRedis(t)
+
+	token, err := IssueRefreshToken(7, "fam-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, familyID, err := RotateRefreshToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 7 || familyID != "fam-1" {
+		t.Fatalf("got user %d family %q", userID, familyID)
+	}
+
+	if _, _, err := RotateRefreshToken("not-issued"); err != ErrInvalidRefreshToken {
+		t.Fatalf("expected ErrInvalidRefreshToken for an unknown token, got %v", err)
+	}
+}
+
+func TestRotateRefreshTokenReuseRevokesFamily(t *testing.T) {
+	startFakeRedis(t)
+
+	stolen, err := IssueRefreshToken(7, "fam-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RotateRefreshToken(stolen); err != nil {
+		t.Fatal(err)
+	}
+	// The legitimate client got a new token from the first rotation.
+	next, err := IssueRefreshToken(7, "fam-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := RotateRefreshToken(stolen); err != ErrRefreshTokenReused {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	revoked, err := IsAccessTokenRevoked("jti-1", "fam-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revoked {
+		t.Fatal("access tokens of the family should be revoked")
+	}
+	if _, _, err := RotateRefreshToken(next); err != ErrInvalidRefreshToken {
+		t.Fatalf("expected the rest of the family to be invalid, got %v", err)
+	}
+
+	if revoked, _ := IsAccessTokenRevoked("jti-2", "fam-2"); revoked {
+		t.Fatal("other families should not be affected")
+	}
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	startFakeRedis(t)
+
+	token, err := IssueRefreshToken(7, "fam-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	familyID, err := LookupRefreshToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RevokeAccessToken("jti-1", time.Now().Add(AccessTokenTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeTokenFamily(familyID); err != nil {
+		t.Fatal(err)
+	}
+
+	if revoked, err := IsAccessTokenRevoked("jti-1", "fam-other"); err != nil || !revoked {
+		t.Fatalf("expected the access token to be revoked, got %v, %v", revoked, err)
+	}
+	if _, _, err := RotateRefreshToken(token); err != ErrInvalidRefreshToken {
+		t.Fatalf("expected the refresh token to be invalid after logout, got %v", err)
+	}
+
+	// Tokens that had already expired need no entry.
+	if err := RevokeAccessToken("jti-old", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := IsAccessTokenRevoked("jti-old", "fam-other"); revoked {
+		t.Fatal("expired access tokens should not be stored")
+	}
+}